@@ -0,0 +1,120 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+//AppendMessage uploads msg, a raw RFC 5322 message, to mailbox mbox creating mbox if it does not exist.
+//flags such as `\Seen` or `\Draft` are set on the new message and date if not zero is its internal date.
+//uid is the UID of the new message if the server supports UIDPLUS, 0 otherwise.
+//Only creating mbox is retried, not the upload: a lost response to APPEND would leave the message twice in mbox.
+func (s *Session) AppendMessage(ctx context.Context, mbox string, msg []byte, flags []string, date time.Time) (uid uint32, err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	if err = s.prepareAppend(ctx, mbox); err != nil {
+		return
+	}
+	return s.append(mbox, flags, date, imap.NewLiteral(msg))
+}
+
+//AppendMessageReader is like AppendMessage but reads the message from r.
+//size is the length of the message, if it is negative r is read into memory first to find it out.
+func (s *Session) AppendMessageReader(ctx context.Context, mbox string, r io.Reader, size int64, flags []string, date time.Time) (uid uint32, err error) {
+	if size < 0 {
+		msg, errR := io.ReadAll(r)
+		if errR != nil {
+			return 0, errR
+		}
+		return s.AppendMessage(ctx, mbox, msg, flags, date)
+	}
+	if size > math.MaxUint32 {
+		return 0, fmt.Errorf("Message of %d bytes is too large", size)
+	}
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	if err = s.prepareAppend(ctx, mbox); err != nil {
+		return
+	}
+	return s.append(mbox, flags, date, &readerLiteral{r, uint32(size)})
+}
+
+//prepareAppend creates mbox if needed before appending to it.
+func (s *Session) prepareAppend(ctx context.Context, mbox string) error {
+	if mbox == "" {
+		return errors.New("No mailbox provided")
+	}
+	return s.retry(ctx, func() error { return s.ensureMbox(mbox, false) })
+}
+
+//append sends APPEND and returns the UID from the APPENDUID response code if any.
+func (s *Session) append(mbox string, flags []string, date time.Time, lit imap.Literal) (uid uint32, err error) {
+	var flagSet imap.FlagSet
+	if len(flags) > 0 {
+		flagSet = imap.NewFlagSet(flags...)
+	}
+	var idate *time.Time
+	if !date.IsZero() {
+		idate = &date
+	}
+	s.log.Debug("Appending", "mailbox", mbox, "bytes", lit.Info().Len)
+	rsp, _, err := s.result(s.c.Append(mbox, flagSet, idate, lit))
+	if err != nil {
+		return
+	}
+	_, uid, err = appendUID(rsp)
+	if err != nil { //The message was appended all the same
+		s.log.Warn("Ignoring APPENDUID", "mailbox", mbox, "error", err)
+		err = nil
+	}
+	return
+}
+
+//appendUID parses the APPENDUID response code of UIDPLUS, RFC 4315, from rsp.
+//It returns the UIDVALIDITY of the mailbox and the UID of the appended message, 0 if there is none.
+func appendUID(rsp *imap.Response) (validity uint32, uid uint32, err error) {
+	args, ok := respCode("APPENDUID", rsp)
+	if !ok {
+		return
+	}
+	if len(args) != 2 {
+		err = fmt.Errorf("Invalid APPENDUID response code with %d arguments", len(args))
+		return
+	}
+	uids, err := fieldUIDs(args[1])
+	if err != nil {
+		return
+	}
+	if len(uids) != 1 {
+		err = fmt.Errorf("APPENDUID has %d UIDs for one message", len(uids))
+		return
+	}
+	return imap.AsNumber(args[0]), uids[0], nil
+}
+
+//readerLiteral is a literal of size bytes read from r.
+type readerLiteral struct {
+	r    io.Reader
+	size uint32
+}
+
+func (l *readerLiteral) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = io.CopyN(w, l.r, int64(l.size))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+func (l *readerLiteral) Info() *imap.LiteralInfo {
+	return &imap.LiteralInfo{Len: l.size}
+}
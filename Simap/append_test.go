@@ -0,0 +1,49 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func Test_readerLiteral(t *testing.T) {
+	msg := "Subject: test\r\n\r\nbody\r\n"
+	var buf bytes.Buffer
+	lit := &readerLiteral{strings.NewReader(msg + "trailing"), uint32(len(msg))}
+	n, err := lit.WriteTo(&buf)
+	if err != nil || n != int64(len(msg)) || buf.String() != msg {
+		t.Errorf("WriteTo wrote %q (%d, %v), want %q", buf.String(), n, err, msg)
+	}
+	if lit.Info().Len != uint32(len(msg)) {
+		t.Errorf("Info().Len = %d, want %d", lit.Info().Len, len(msg))
+	}
+	short := &readerLiteral{strings.NewReader("short"), 10}
+	if _, err := short.WriteTo(io.Discard); err != io.ErrUnexpectedEOF {
+		t.Errorf("a reader shorter than size should give io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func Test_appendUID(t *testing.T) {
+	tests := []struct {
+		fields        []imap.Field
+		validity, uid uint32
+		wantErr       bool
+	}{
+		{[]imap.Field{"APPENDUID", uint32(38505), uint32(3955)}, 38505, 3955, false},
+		{[]imap.Field{uint32(38505), "3955"}, 38505, 3955, false},
+		{[]imap.Field{"APPENDUID", uint32(38505)}, 0, 0, true},
+		{[]imap.Field{"APPENDUID", uint32(38505), "3955:3956"}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		rsp := &imap.Response{Type: imap.Done, Status: imap.OK, Label: "APPENDUID", Fields: tt.fields}
+		validity, uid, err := appendUID(rsp)
+		if (err != nil) != tt.wantErr || validity != tt.validity || uid != tt.uid {
+			t.Errorf("appendUID(%v) = %d, %d, %v, want %d, %d", tt.fields, validity, uid, err, tt.validity, tt.uid)
+		}
+	}
+	if _, uid, err := appendUID(&imap.Response{Type: imap.Done, Status: imap.OK}); uid != 0 || err != nil {
+		t.Errorf("without APPENDUID there should be no UID and no error, got %d, %v", uid, err)
+	}
+}
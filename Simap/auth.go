@@ -0,0 +1,309 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//TokenSource supplies OAuth 2.0 access tokens for XOAUTH2 and OAUTHBEARER.
+//Token is called at every login and must return a valid token, refreshing it if it has expired.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+//TokenSourceFunc adapts a function to a TokenSource.
+type TokenSourceFunc func() (string, error)
+
+func (f TokenSourceFunc) Token() (string, error) {
+	return f()
+}
+
+//Mechanism is an authentication mechanism login can negotiate with the server.
+type Mechanism struct {
+	//Name is the SASL mechanism name advertised by the server as AUTH=Name.
+	//The name LOGIN stands for the LOGIN command, which is available unless the server advertises LOGINDISABLED.
+	Name string
+	//OAuth mechanisms authenticate with a token of IMAPAccount.TokenSource, the others with the password.
+	OAuth bool
+	//New returns the SASL client authenticating user with secret. It is nil for LOGIN.
+	New func(user, secret string, server *IMAPServer) imap.SASL
+}
+
+//Mechanisms are the authentication mechanisms login chooses from, in order of preference.
+//The first one supported by the server for which the account has credentials is used.
+//Applications can reorder them or add their own.
+var Mechanisms = []Mechanism{
+	{"OAUTHBEARER", true, func(user, token string, server *IMAPServer) imap.SASL {
+		return OAuthBearerAuth(user, token, server.Host, server.Port)
+	}},
+	{"XOAUTH2", true, func(user, token string, server *IMAPServer) imap.SASL {
+		return XOAuth2Auth(user, token)
+	}},
+	{"SCRAM-SHA-256", false, func(user, pass string, server *IMAPServer) imap.SASL {
+		return ScramSHA256Auth(user, pass)
+	}},
+	{"CRAM-MD5", false, func(user, pass string, server *IMAPServer) imap.SASL {
+		return CramMD5Auth(user, pass)
+	}},
+	{"PLAIN", false, func(user, pass string, server *IMAPServer) imap.SASL {
+		return PlainAuth(user, pass)
+	}},
+	{"LOGIN", false, nil},
+}
+
+//ErrNoMechanism is returned when the server supports none of the authentication mechanisms
+//usable with the credentials of the account.
+var ErrNoMechanism = errors.New("No common authentication mechanism")
+
+//login authenticates to the server with the credentials of acct.
+func login(c *imap.Client, acct *IMAPAccount) (cmd *imap.Command, err error) {
+	m, err := chooseMechanism(c.Caps, acct)
+	if err != nil {
+		return
+	}
+
+	var secret string
+	if m.OAuth {
+		secret, err = acct.TokenSource.Token()
+		if err != nil {
+			err = fmt.Errorf("Getting OAuth token: %s", err)
+			return
+		}
+	} else {
+		secret, err = acct.password()
+		if err != nil {
+			err = fmt.Errorf("Getting password: %s", err)
+			return
+		}
+	}
+	if m.New == nil {
+		defer c.SetLogMask(sensitive(c, "LOGIN"))
+		return c.Login(acct.Username, secret)
+	}
+	defer c.SetLogMask(sensitive(c, "AUTHENTICATE"))
+	return c.Auth(m.New(acct.Username, secret, acct.Server))
+}
+
+//chooseMechanism picks the mechanism for acct among those advertised in caps.
+func chooseMechanism(caps map[string]bool, acct *IMAPAccount) (m Mechanism, err error) {
+	supported := func(m Mechanism) bool {
+		if m.Name == "LOGIN" {
+			return !caps["LOGINDISABLED"]
+		}
+		return caps["AUTH="+m.Name]
+	}
+	usable := func(m Mechanism) bool {
+		if m.OAuth {
+			return acct.TokenSource != nil
+		}
+		return acct.Password != "" || acct.Credentials != nil
+	}
+
+	for _, m = range Mechanisms {
+		if acct.Mechanism != "" && !strings.EqualFold(m.Name, acct.Mechanism) {
+			continue
+		}
+		if supported(m) && usable(m) {
+			return
+		}
+		if acct.Mechanism != "" {
+			err = fmt.Errorf("%w: %s is not supported by the server or has no credentials", ErrNoMechanism, m.Name)
+			return
+		}
+	}
+	if acct.Mechanism != "" {
+		err = fmt.Errorf("%w: unknown mechanism %s", ErrNoMechanism, acct.Mechanism)
+		return
+	}
+
+	var offered []string
+	for c := range caps {
+		if strings.HasPrefix(c, "AUTH=") {
+			offered = append(offered, c[len("AUTH="):])
+		}
+	}
+	sort.Strings(offered)
+	if !caps["LOGINDISABLED"] {
+		offered = append(offered, "LOGIN")
+	}
+	err = fmt.Errorf("%w: server offers %s", ErrNoMechanism, strings.Join(offered, " "))
+	return
+}
+
+type plainAuth struct {
+	user, pass string
+}
+
+//PlainAuth returns the SASL PLAIN mechanism of RFC 4616.
+func PlainAuth(user, pass string) imap.SASL {
+	return &plainAuth{user, pass}
+}
+
+func (a *plainAuth) Start(s *imap.ServerInfo) (mech string, ir []byte, err error) {
+	return "PLAIN", []byte("\x00" + a.user + "\x00" + a.pass), nil
+}
+
+func (a *plainAuth) Next(challenge []byte) (response []byte, err error) {
+	return nil, errors.New("Unexpected PLAIN challenge")
+}
+
+type cramMD5Auth struct {
+	user, pass string
+}
+
+//CramMD5Auth returns the SASL CRAM-MD5 mechanism of RFC 2195.
+func CramMD5Auth(user, pass string) imap.SASL {
+	return &cramMD5Auth{user, pass}
+}
+
+func (a *cramMD5Auth) Start(s *imap.ServerInfo) (mech string, ir []byte, err error) {
+	return "CRAM-MD5", nil, nil
+}
+
+func (a *cramMD5Auth) Next(challenge []byte) (response []byte, err error) {
+	d := hmac.New(md5.New, []byte(a.pass))
+	d.Write(challenge)
+	return []byte(a.user + " " + hex.EncodeToString(d.Sum(nil))), nil
+}
+
+type scramAuth struct {
+	user, pass string
+
+	nonce           string //Client nonce
+	clientFirstBare string
+	serverSignature []byte
+}
+
+//ScramSHA256Auth returns the SASL SCRAM-SHA-256 mechanism of RFC 7677, without channel binding.
+func ScramSHA256Auth(user, pass string) imap.SASL {
+	return &scramAuth{user: user, pass: pass}
+}
+
+func (a *scramAuth) Start(s *imap.ServerInfo) (mech string, ir []byte, err error) {
+	if a.nonce == "" {
+		b := make([]byte, 18)
+		if _, err = rand.Read(b); err != nil {
+			return
+		}
+		a.nonce = base64.StdEncoding.EncodeToString(b)
+	}
+	a.clientFirstBare = "n=" + saslName(a.user) + ",r=" + a.nonce
+	return "SCRAM-SHA-256", []byte("n,," + a.clientFirstBare), nil
+}
+
+func (a *scramAuth) Next(challenge []byte) (response []byte, err error) {
+	attrs := scramAttrs(string(challenge))
+	if e, ok := attrs["e"]; ok {
+		return nil, fmt.Errorf("SCRAM-SHA-256: server error %s", e)
+	}
+	if a.serverSignature != nil { //server-final-message
+		v, errD := base64.StdEncoding.DecodeString(attrs["v"])
+		if errD != nil || !hmac.Equal(v, a.serverSignature) {
+			return nil, errors.New("SCRAM-SHA-256: invalid server signature")
+		}
+		return []byte{}, nil
+	}
+
+	//server-first-message
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, a.nonce) || len(nonce) == len(a.nonce) {
+		return nil, errors.New("SCRAM-SHA-256: invalid server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return nil, errors.New("SCRAM-SHA-256: invalid salt")
+	}
+	iter, err := strconv.Atoi(attrs["i"])
+	if err != nil || iter <= 0 {
+		return nil, errors.New("SCRAM-SHA-256: invalid iteration count")
+	}
+
+	salted, err := pbkdf2.Key(sha256.New, a.pass, salt, iter, sha256.Size)
+	if err != nil {
+		return
+	}
+	clientKey := scramHMAC(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	withoutProof := "c=biws,r=" + nonce
+	authMessage := a.clientFirstBare + "," + string(challenge) + "," + withoutProof
+
+	proof := scramHMAC(storedKey[:], authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	a.serverSignature = scramHMAC(scramHMAC(salted, "Server Key"), authMessage)
+	return []byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+func scramHMAC(key []byte, msg string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(msg))
+	return h.Sum(nil)
+}
+
+//scramAttrs splits a SCRAM message into its attributes.
+func scramAttrs(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, kv := range strings.Split(msg, ",") {
+		if len(kv) >= 2 && kv[1] == '=' {
+			attrs[kv[:1]] = kv[2:]
+		}
+	}
+	return attrs
+}
+
+type xoauth2 struct {
+	user, token string
+}
+
+//XOAuth2Auth returns the SASL XOAUTH2 mechanism used by Gmail and Microsoft 365.
+func XOAuth2Auth(user, token string) imap.SASL {
+	return &xoauth2{user, token}
+}
+
+func (a *xoauth2) Start(s *imap.ServerInfo) (mech string, ir []byte, err error) {
+	ir = []byte("user=" + a.user + "\x01auth=Bearer " + a.token + "\x01\x01")
+	return "XOAUTH2", ir, nil
+}
+
+func (a *xoauth2) Next(challenge []byte) (response []byte, err error) {
+	//The only challenge is a JSON error, an empty response makes the server fail the command.
+	return []byte{}, nil
+}
+
+type oauthBearer struct {
+	user, token, host string
+	port              uint16
+}
+
+//OAuthBearerAuth returns the SASL OAUTHBEARER mechanism of RFC 7628.
+func OAuthBearerAuth(user, token, host string, port uint16) imap.SASL {
+	return &oauthBearer{user, token, host, port}
+}
+
+func (a *oauthBearer) Start(s *imap.ServerInfo) (mech string, ir []byte, err error) {
+	ir = []byte(fmt.Sprintf("n,a=%s,\x01host=%s\x01port=%d\x01auth=Bearer %s\x01\x01",
+		saslName(a.user), a.host, a.port, a.token))
+	return "OAUTHBEARER", ir, nil
+}
+
+func (a *oauthBearer) Next(challenge []byte) (response []byte, err error) {
+	//RFC 7628 3.2.3: the client answers the error challenge with a single %x01.
+	return []byte{0x01}, nil
+}
+
+//saslName escapes a username as required by RFC 5801 and RFC 5802.
+func saslName(s string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(s)
+}
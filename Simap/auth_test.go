@@ -0,0 +1,106 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_XOAuth2Auth(t *testing.T) {
+	mech, ir, err := XOAuth2Auth("someuser@example.com", "ya29.vF9dft4qmTc2Nvb3RlckBhdHRhdmlzdGEuY29tCg").Start(&imap.ServerInfo{Name: "server.example.com", TLS: true})
+	if err != nil || mech != "XOAUTH2" {
+		t.Fatalf("Start returned %q, %v", mech, err)
+	}
+	expected := "user=someuser@example.com\x01auth=Bearer ya29.vF9dft4qmTc2Nvb3RlckBhdHRhdmlzdGEuY29tCg\x01\x01"
+	if string(ir) != expected {
+		t.Errorf("initial response should be %q, got %q", expected, ir)
+	}
+}
+
+func Test_OAuthBearerAuth(t *testing.T) {
+	a := OAuthBearerAuth("user,=1@example.com", "vF9dft4qmTc2Nvb3RlckBhbHRhdmlzdGEuY29tCg==", "server.example.com", 143)
+	mech, ir, err := a.Start(&imap.ServerInfo{Name: "server.example.com", TLS: true})
+	if err != nil || mech != "OAUTHBEARER" {
+		t.Fatalf("Start returned %q, %v", mech, err)
+	}
+	expected := "n,a=user=2C=3D1@example.com,\x01host=server.example.com\x01port=143\x01auth=Bearer vF9dft4qmTc2Nvb3RlckBhbHRhdmlzdGEuY29tCg==\x01\x01"
+	if string(ir) != expected {
+		t.Errorf("initial response should be %q, got %q", expected, ir)
+	}
+	if rsp, _ := a.Next([]byte(`{"status":"invalid_token"}`)); string(rsp) != "\x01" {
+		t.Errorf("error challenge should be answered with %%x01, got %q", rsp)
+	}
+}
+
+func Test_CramMD5Auth(t *testing.T) {
+	//RFC 2195 section 2
+	rsp, err := CramMD5Auth("tim", "tanstaaftanstaaf").Next([]byte("<1896.697170952@postoffice.reston.mci.net>"))
+	expected := "tim b913a602c7eda7a495b4e6e7334d3890"
+	if err != nil || string(rsp) != expected {
+		t.Errorf("response should be %q, got %q, %v", expected, rsp, err)
+	}
+}
+
+func Test_ScramSHA256Auth(t *testing.T) {
+	//RFC 7677 section 3
+	a := &scramAuth{user: "user", pass: "pencil", nonce: "rOprNGfwEbeRWgbNEkqO"}
+	_, ir, err := a.Start(&imap.ServerInfo{})
+	if err != nil || string(ir) != "n,,n=user,r=rOprNGfwEbeRWgbNEkqO" {
+		t.Fatalf("client-first-message is %q, %v", ir, err)
+	}
+	rsp, err := a.Next([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"))
+	expected := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	if err != nil || string(rsp) != expected {
+		t.Fatalf("client-final-message should be %q, got %q, %v", expected, rsp, err)
+	}
+	if _, err = a.Next([]byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")); err != nil {
+		t.Errorf("valid server signature rejected: %s", err)
+	}
+
+	a = &scramAuth{user: "user", pass: "wrong", nonce: "rOprNGfwEbeRWgbNEkqO"}
+	a.Start(&imap.ServerInfo{})
+	a.Next([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"))
+	if _, err = a.Next([]byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")); err == nil {
+		t.Errorf("server signature for another password should be rejected")
+	}
+}
+
+func Test_chooseMechanism(t *testing.T) {
+	password := &IMAPAccount{Username: "u", Password: "p"}
+	oauth := &IMAPAccount{Username: "u", TokenSource: TokenSourceFunc(func() (string, error) { return "t", nil })}
+	tests := []struct {
+		caps     string
+		acct     *IMAPAccount
+		pin      string
+		expected string
+	}{
+		{"IMAP4rev1 AUTH=PLAIN AUTH=SCRAM-SHA-256", password, "", "SCRAM-SHA-256"},
+		{"IMAP4rev1 AUTH=PLAIN AUTH=CRAM-MD5", password, "", "CRAM-MD5"},
+		{"IMAP4rev1", password, "", "LOGIN"},
+		{"IMAP4rev1 AUTH=PLAIN AUTH=SCRAM-SHA-256", password, "plain", "PLAIN"},
+		{"IMAP4rev1 AUTH=XOAUTH2 AUTH=PLAIN", oauth, "", "XOAUTH2"},
+		{"IMAP4rev1 AUTH=XOAUTH2 AUTH=OAUTHBEARER", oauth, "", "OAUTHBEARER"},
+		{"IMAP4rev1 LOGINDISABLED", password, "", ""},
+		{"IMAP4rev1 AUTH=PLAIN", oauth, "", ""},
+		{"IMAP4rev1 AUTH=PLAIN", password, "SCRAM-SHA-256", ""},
+	}
+	for _, test := range tests {
+		caps := make(map[string]bool)
+		for _, c := range strings.Fields(test.caps) {
+			caps[c] = true
+		}
+		acct := *test.acct
+		acct.Mechanism = test.pin
+		m, err := chooseMechanism(caps, &acct)
+		if test.expected == "" {
+			if !errors.Is(err, ErrNoMechanism) {
+				t.Errorf("%s with pin %q: expected ErrNoMechanism, got %s, %v", test.caps, test.pin, m.Name, err)
+			}
+			continue
+		}
+		if err != nil || m.Name != test.expected {
+			t.Errorf("%s with pin %q: expected %s, got %s, %v", test.caps, test.pin, test.expected, m.Name, err)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//ErrNoCondStore is returned by the methods using mod-sequences if the server does not support CONDSTORE, RFC 7162,
+//or does not keep mod-sequences for the mailbox.
+var ErrNoCondStore = errors.New("Server does not support CONDSTORE")
+
+//ErrUIDValidity is returned by ChangesSince if the UIDVALIDITY of the mailbox changed, which invalidates all UIDs known for it.
+var ErrUIDValidity = errors.New("UIDVALIDITY of the mailbox changed")
+
+//ErrModified is the error of the messages which a conditional STORE left as they were
+//because they were modified since the given mod-sequence.
+var ErrModified = errors.New("Message was modified meanwhile")
+
+//FlagChange is the current flags of a message whose flags changed.
+type FlagChange struct {
+	UID    uint32
+	Flags  []string //Sorted
+	ModSeq uint64   //Mod-sequence of the last change of the message
+}
+
+//Changes are the changes to the messages of a mailbox since a mod-sequence, see ChangesSince.
+type Changes struct {
+	Mailbox       string
+	UIDValidity   uint32
+	HighestModSeq uint64 //The changes are complete up to this mod-sequence
+	Flags         []FlagChange
+	Vanished      []uint32 //UIDs of the expunged messages, ascending
+	//VanishedKnown is false if the server does not support QRESYNC, RFC 7162, so Vanished is always empty.
+	VanishedKnown bool
+}
+
+//condStore tells whether a server with capabilities caps supports CONDSTORE, which QRESYNC implies.
+func condStore(caps map[string]bool) bool {
+	return caps["CONDSTORE"] || caps["QRESYNC"]
+}
+
+//ChangesSince returns the changes to the messages up to cp.LastUID of mailbox mbox since mod-sequence cp.HighestModSeq:
+//the current flags of the messages whose flags changed and, if the server supports QRESYNC, the UIDs of the expunged ones.
+//Newer messages are left to SyncEMails. Changes.HighestModSeq is where to ask from next time.
+//It returns ErrUIDValidity if cp.UIDValidity is not the UIDVALIDITY of mbox any more and
+//ErrNoCondStore if the server does not support CONDSTORE, RFC 7162.
+//
+//QRESYNC is enabled on the connection of the session, after which the server reports expunged messages
+//to Watch as WatchVanished events instead of WatchExpunge events.
+func (s *Session) ChangesSince(ctx context.Context, mbox string, cp Checkpoint) (ch *Changes, err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	return s.changesSince(ctx, mbox, cp)
+}
+
+func (s *Session) changesSince(ctx context.Context, mbox string, cp Checkpoint) (ch *Changes, err error) {
+	if !condStore(s.c.Caps) {
+		return nil, ErrNoCondStore
+	}
+	if mbox == "" {
+		mbox = "inbox"
+	}
+	err = s.retry(ctx, func() (err error) {
+		ch = &Changes{Mailbox: mbox, VanishedKnown: s.c.Caps["QRESYNC"]}
+		if ch.VanishedKnown {
+			if err = s.enableQResync(); err != nil {
+				return
+			}
+		}
+		//The changes after STATUS are reported now and again next time, none is lost
+		st, err := s.status(mbox, "UIDVALIDITY", "HIGHESTMODSEQ")
+		if err != nil {
+			return
+		}
+		if st.UIDValidity != cp.UIDValidity {
+			return ErrUIDValidity
+		}
+		if st.HighestModSeq == 0 {
+			return ErrNoCondStore
+		}
+		ch.UIDValidity, ch.HighestModSeq = st.UIDValidity, st.HighestModSeq
+		if cp.LastUID == 0 || st.HighestModSeq <= cp.HighestModSeq {
+			return
+		}
+		if err = s.selectMbox(mbox, true); err != nil {
+			return
+		}
+		return s.fetchChanges(ch, cp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("Fetched changes", "mailbox", mbox, "modSeq", cp.HighestModSeq, "highestModSeq", ch.HighestModSeq,
+		"flags", len(ch.Flags), "vanished", len(ch.Vanished))
+	return
+}
+
+//fetchChanges fetches the flags of the messages up to cp.LastUID changed since cp.HighestModSeq
+//with CHANGEDSINCE, and the expunged ones with VANISHED if QRESYNC is enabled, into ch.
+func (s *Session) fetchChanges(ch *Changes, cp Checkpoint) (err error) {
+	set := new(imap.SeqSet)
+	set.AddRange(1, cp.LastUID)
+	modifiers := []imap.Field{"CHANGEDSINCE", strconv.FormatUint(cp.HighestModSeq, 10)}
+	if ch.VanishedKnown {
+		modifiers = append(modifiers, "VANISHED")
+	}
+	_, data, err := s.result(s.c.Send("UID FETCH", set, []imap.Field{"UID", "FLAGS", "MODSEQ"}, modifiers))
+	if err != nil {
+		return
+	}
+	//VANISHED responses are not FETCH responses, the imap package leaves them in the unilateral data
+	data = append(data, s.c.Data...)
+	s.c.Data = withoutLabel(s.c.Data, "VANISHED")
+	for _, rsp := range data {
+		switch rsp.Label {
+		case "FETCH":
+			fc, ok, err1 := flagChange(rsp)
+			if err1 != nil {
+				return err1
+			}
+			if ok {
+				ch.Flags = append(ch.Flags, fc)
+				ch.HighestModSeq = max(ch.HighestModSeq, fc.ModSeq)
+			}
+		case "VANISHED":
+			uids, err1 := vanishedUIDs(rsp)
+			if err1 != nil {
+				return err1
+			}
+			ch.Vanished = append(ch.Vanished, uids...)
+		}
+	}
+	sort.Slice(ch.Vanished, func(i, j int) bool { return ch.Vanished[i] < ch.Vanished[j] })
+	return
+}
+
+//enableQResync enables QRESYNC on the connection, which is only possible while no mailbox is selected.
+func (s *Session) enableQResync() (err error) {
+	if s.qresync {
+		return
+	}
+	if s.c.State() == imap.Selected {
+		if err = s.closeMbox(); err != nil {
+			return
+		}
+	}
+	if s.c.CommandConfig["ENABLE"] == nil { //Unknown to the imap package
+		s.c.CommandConfig["ENABLE"] = &imap.CommandConfig{
+			States: imap.Auth,
+			Filter: imap.LabelFilter("ENABLED"),
+		}
+	}
+	if err = s.wait(s.c.Send("ENABLE", "QRESYNC")); err != nil {
+		return
+	}
+	s.qresync = true
+	return
+}
+
+//flagChange returns the FlagChange of a FETCH response, ok is false if it has no UID.
+func flagChange(rsp *imap.Response) (fc FlagChange, ok bool, err error) {
+	info := rsp.MessageInfo()
+	if info == nil || info.UID == 0 {
+		return
+	}
+	fc.UID = info.UID
+	for flag := range info.Flags {
+		fc.Flags = append(fc.Flags, flag)
+	}
+	sort.Strings(fc.Flags)
+	if list := imap.AsList(info.Attrs["MODSEQ"]); len(list) == 1 {
+		if fc.ModSeq, err = fieldNumber(list[0]); err != nil {
+			return
+		}
+	}
+	return fc, true, nil
+}
+
+//vanishedUIDs returns the UIDs of a VANISHED response: VANISHED [(EARLIER)] uid-set.
+func vanishedUIDs(rsp *imap.Response) ([]uint32, error) {
+	fields := rsp.Fields
+	if len(fields) > 0 && imap.TypeOf(fields[0]) == imap.Atom && strings.EqualFold(imap.AsAtom(fields[0]), "VANISHED") {
+		fields = fields[1:]
+	}
+	if len(fields) > 0 && imap.TypeOf(fields[0]) == imap.List {
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		return nil, errors.New("Invalid VANISHED response")
+	}
+	return fieldUIDs(fields[0])
+}
+
+//withoutLabel returns the responses of rsps not labelled label.
+func withoutLabel(rsps []*imap.Response, label string) (rest []*imap.Response) {
+	for _, rsp := range rsps {
+		if rsp.Label != label {
+			rest = append(rest, rsp)
+		}
+	}
+	return
+}
+
+//SyncChanges passes the changes to the messages of mailbox mbox since its checkpoint in store to fn,
+//see ChangesSince, and records Changes.HighestModSeq in store if fn returns nil.
+//Together with SyncEMails, which delivers the new messages, it keeps a copy of mbox up to date.
+//If there is no checkpoint for mbox yet or its UIDVALIDITY changed, fn is not called and resync is true:
+//SyncEMails must deliver all messages again first.
+func (s *Session) SyncChanges(ctx context.Context, mbox string, store CheckpointStore, fn func(*Changes) error) (resync bool, err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+
+	if mbox == "" {
+		mbox = "inbox"
+	}
+	account := s.acct.Username + "@" + s.acct.Server.Host
+	cp, ok, err := store.Load(account, mbox)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return true, nil
+	}
+	ch, err := s.changesSince(ctx, mbox, cp)
+	if errors.Is(err, ErrUIDValidity) {
+		return true, nil
+	}
+	if err != nil {
+		return
+	}
+	if err = fn(ch); err != nil {
+		return
+	}
+	if ch.HighestModSeq == cp.HighestModSeq {
+		return
+	}
+	//SyncEMails may have delivered new messages meanwhile
+	if cp, _, err = store.Load(account, mbox); err != nil {
+		return
+	}
+	cp.HighestModSeq = ch.HighestModSeq
+	err = store.Save(account, mbox, cp)
+	return
+}
+
+//MarkEmailsUnchangedSince is like MarkEmails but leaves the messages whose flags changed since mod-sequence modSeq,
+//such as the Changes.HighestModSeq the caller last applied, as they are, using UNCHANGEDSINCE of CONDSTORE, RFC 7162.
+//They are reported in res.Failed with ErrModified, so that the caller can look at their new flags before trying again.
+func (s *Session) MarkEmailsUnchangedSince(ctx context.Context, src string, imapFlag string, uids []uint32, modSeq uint64, jobSize int) (res *Result, err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	if !condStore(s.c.Caps) {
+		return nil, ErrNoCondStore
+	}
+	return s.storeFlags("Marking", "+FLAGS.SILENT", src, imapFlag, uids, modSeq, jobSize)
+}
+
+//UnMarkEmailsUnchangedSince is like UnMarkEmails but leaves the messages whose flags changed since mod-sequence modSeq
+//as they are, see MarkEmailsUnchangedSince.
+func (s *Session) UnMarkEmailsUnchangedSince(ctx context.Context, src string, imapFlag string, uids []uint32, modSeq uint64, jobSize int) (res *Result, err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	if !condStore(s.c.Caps) {
+		return nil, ErrNoCondStore
+	}
+	return s.storeFlags("UnMarking", "-FLAGS.SILENT", src, imapFlag, uids, modSeq, jobSize)
+}
+
+//storeUnchangedSince is UID STORE with the UNCHANGEDSINCE modifier.
+//It returns the UIDs of the messages left unchanged because they were modified since modSeq.
+func (s *Session) storeUnchangedSince(uids []uint32, item string, imapFlag string, modSeq uint64) (modified []uint32, err error) {
+	unchangedSince := []imap.Field{"UNCHANGEDSINCE", strconv.FormatUint(modSeq, 10)}
+	rsp, _, err := s.result(s.c.Send("UID STORE", uidSet(uids), unchangedSince, item, imap.NewFlagSet(imapFlag)))
+	if err != nil {
+		return
+	}
+	return modifiedUIDs(rsp)
+}
+
+//modifiedUIDs returns the UIDs of the MODIFIED response code of rsp, none if it has none.
+func modifiedUIDs(rsp *imap.Response) (uids []uint32, err error) {
+	args, ok := respCode("MODIFIED", rsp)
+	if !ok {
+		return
+	}
+	if len(args) != 1 {
+		return nil, errors.New("Invalid MODIFIED response code")
+	}
+	return fieldUIDs(args[0])
+}
@@ -0,0 +1,79 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func Test_vanishedUIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  []imap.Field
+		want    []uint32
+		wantErr bool
+	}{
+		{"EARLIER", []imap.Field{"VANISHED", []imap.Field{"EARLIER"}, "41,43:45,47"}, []uint32{41, 43, 44, 45, 47}, false},
+		{"live", []imap.Field{"VANISHED", "405"}, []uint32{405}, false},
+		{"single number", []imap.Field{"VANISHED", uint32(405)}, []uint32{405}, false},
+		{"without label", []imap.Field{[]imap.Field{"EARLIER"}, "1:2"}, []uint32{1, 2}, false},
+		{"no uid-set", []imap.Field{"VANISHED", []imap.Field{"EARLIER"}}, nil, true},
+		{"bad uid-set", []imap.Field{"VANISHED", "4:x"}, nil, true},
+	}
+	for _, tt := range tests {
+		uids, err := vanishedUIDs(&imap.Response{Type: imap.Data, Label: "VANISHED", Fields: tt.fields})
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(uids, tt.want) {
+			t.Errorf("%s: vanishedUIDs = %v, %v, want %v", tt.name, uids, err, tt.want)
+		}
+	}
+}
+
+func Test_flagChange(t *testing.T) {
+	rsp := &imap.Response{Type: imap.Data, Label: "FETCH", Fields: []imap.Field{uint32(12), "FETCH", []imap.Field{
+		"UID", uint32(812), "FLAGS", []imap.Field{`\Seen`, `$Junk`}, "MODSEQ", []imap.Field{"9876543210"}}}}
+	fc, ok, err := flagChange(rsp)
+	want := FlagChange{UID: 812, Flags: []string{`$Junk`, `\Seen`}, ModSeq: 9876543210}
+	if !ok || err != nil || !reflect.DeepEqual(fc, want) {
+		t.Errorf("flagChange = %+v, %v, %v, want %+v", fc, ok, err, want)
+	}
+
+	rsp.Fields[2] = []imap.Field{"UID", uint32(812), "FLAGS", []imap.Field{}, "MODSEQ", []imap.Field{uint32(17)}}
+	if fc, ok, _ := flagChange(rsp); !ok || fc.ModSeq != 17 || len(fc.Flags) != 0 {
+		t.Errorf("flagChange with no flags and a small MODSEQ = %+v, %v", fc, ok)
+	}
+
+	rsp.Fields[2] = []imap.Field{"UID", uint32(812), "MODSEQ", []imap.Field{"bad"}}
+	if _, _, err := flagChange(rsp); err == nil {
+		t.Errorf("a malformed MODSEQ should give an error")
+	}
+
+	rsp.Fields[2] = []imap.Field{"FLAGS", []imap.Field{`\Seen`}}
+	if _, ok, _ := flagChange(rsp); ok {
+		t.Errorf("a FETCH without UID is no change a sync client can apply")
+	}
+}
+
+func Test_modifiedUIDs(t *testing.T) {
+	rsp := &imap.Response{Type: imap.Done, Status: imap.OK, Label: "MODIFIED", Fields: []imap.Field{"MODIFIED", "7,9:10"}}
+	modified, err := modifiedUIDs(rsp)
+	if err != nil || !reflect.DeepEqual(modified, []uint32{7, 9, 10}) {
+		t.Fatalf("modifiedUIDs = %v, %v, want [7 9 10]", modified, err)
+	}
+	res := new(Result)
+	res.splitModified([]uint32{6, 7, 8, 9, 10}, modified)
+	if !reflect.DeepEqual(res.Succeeded, []uint32{6, 8}) || !reflect.DeepEqual(res.FailedUIDs(), []uint32{7, 9, 10}) {
+		t.Errorf("Succeeded = %v, Failed = %v", res.Succeeded, res.FailedUIDs())
+	}
+	if !errors.Is(res.err("Marking"), ErrModified) {
+		t.Errorf("the modified UIDs should fail with ErrModified")
+	}
+
+	if modified, err := modifiedUIDs(&imap.Response{Type: imap.Done, Status: imap.OK}); modified != nil || err != nil {
+		t.Errorf("without MODIFIED all messages were stored, got %v, %v", modified, err)
+	}
+	bad := &imap.Response{Type: imap.Done, Status: imap.OK, Label: "MODIFIED", Fields: []imap.Field{"MODIFIED"}}
+	if _, err := modifiedUIDs(bad); err == nil {
+		t.Errorf("MODIFIED without a uid-set should give an error")
+	}
+}
@@ -0,0 +1,197 @@
+package Simap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+//CredentialProvider supplies the password of an account.
+//It is called at every login so the password is never kept longer than needed.
+type CredentialProvider interface {
+	Password(acct *IMAPAccount) (string, error)
+}
+
+//password returns acct.Password or else the password of acct.Credentials.
+func (acct *IMAPAccount) password() (string, error) {
+	if acct.Password != "" || acct.Credentials == nil {
+		return acct.Password, nil
+	}
+	return acct.Credentials.Password(acct)
+}
+
+//EnvCredentials reads the password from the environment variable Var.
+type EnvCredentials struct {
+	Var string
+}
+
+func (e EnvCredentials) Password(acct *IMAPAccount) (string, error) {
+	pass, ok := os.LookupEnv(e.Var)
+	if !ok {
+		return "", fmt.Errorf("Environment variable %s is not set", e.Var)
+	}
+	return pass, nil
+}
+
+//NetrcCredentials looks up the password in a .netrc file by the host and username of the account.
+//Path defaults to ~/.netrc (~/_netrc on Windows), or the file named by the NETRC environment variable.
+type NetrcCredentials struct {
+	Path string
+}
+
+func (n NetrcCredentials) Password(acct *IMAPAccount) (string, error) {
+	path := n.Path
+	if path == "" {
+		var err error
+		if path, err = netrcPath(); err != nil {
+			return "", err
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	pass, ok := netrcLookup(string(data), acct.Server.Host, acct.Username)
+	if !ok {
+		return "", fmt.Errorf("No entry for %s@%s in %s", acct.Username, acct.Server.Host, path)
+	}
+	return pass, nil
+}
+
+func netrcPath() (string, error) {
+	if env := os.Getenv("NETRC"); env != "" {
+		return env, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	name := ".netrc"
+	if filepath.Separator == '\\' {
+		name = "_netrc"
+	}
+	return filepath.Join(home, name), nil
+}
+
+//netrcLookup returns the password of the first entry of netrc matching machine and login.
+//An entry without login matches any login and the default entry matches any machine.
+func netrcLookup(netrc string, machine string, login string) (pass string, found bool) {
+	var tokens []string
+	inMacro := false
+	for _, line := range strings.Split(netrc, "\n") {
+		if inMacro { //Macro definitions run until the next empty line
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		for _, tok := range strings.Fields(line) {
+			if tok == "macdef" {
+				inMacro = true
+				break
+			}
+			tokens = append(tokens, tok)
+		}
+	}
+
+	type entry struct {
+		machine, login, password string
+		isDefault                bool
+	}
+	var entries []*entry
+	var e *entry
+	for i := 0; i < len(tokens); i++ {
+		var value string
+		if i+1 < len(tokens) {
+			value = tokens[i+1]
+		}
+		switch tokens[i] {
+		case "machine":
+			e = &entry{machine: value}
+			entries = append(entries, e)
+			i++
+		case "default":
+			e = &entry{isDefault: true}
+			entries = append(entries, e)
+		case "login", "password", "account":
+			if e != nil && tokens[i] == "login" {
+				e.login = value
+			} else if e != nil && tokens[i] == "password" {
+				e.password = value
+			}
+			i++
+		}
+	}
+
+	for _, e := range entries {
+		if (e.isDefault || e.machine == machine) && (e.login == "" || e.login == login) {
+			return e.password, true
+		}
+	}
+	return
+}
+
+//CommandCredentials runs an external command to get the password, like git credential helpers.
+//The command gets protocol, host, port and username as key=value lines on its standard input.
+//Its output is either key=value lines including password=..., or the password on the first line.
+type CommandCredentials struct {
+	Name string
+	Args []string
+}
+
+func (cc CommandCredentials) Password(acct *IMAPAccount) (string, error) {
+	cmd := exec.Command(cc.Name, cc.Args...)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=imap\nhost=%s\nport=%d\nusername=%s\n\n",
+		acct.Server.Host, acct.Server.Port, acct.Username))
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Running %s: %s", cc.Name, err)
+	}
+
+	var first string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for i := 0; sc.Scan(); i++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if i == 0 {
+			first = line
+		}
+		if strings.HasPrefix(line, "password=") {
+			return line[len("password="):], nil
+		}
+	}
+	if first == "" {
+		return "", fmt.Errorf("%s printed no password", cc.Name)
+	}
+	return first, nil
+}
+
+//FileCredentials reads the password from the first line of a file.
+//The file must not be accessible by group or others, e.g. chmod 600.
+type FileCredentials struct {
+	Path string
+}
+
+func (f FileCredentials) Password(acct *IMAPAccount) (string, error) {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return "", err
+	}
+	if filepath.Separator != '\\' && info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("%s is accessible by others (mode %#o), it should be 0600", f.Path, uint32(info.Mode().Perm()))
+	}
+	data, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return "", err
+	}
+	pass := strings.SplitN(string(data), "\n", 2)[0]
+	pass = strings.TrimRight(pass, "\r")
+	if pass == "" {
+		return "", errors.New(f.Path + " is empty")
+	}
+	return pass, nil
+}
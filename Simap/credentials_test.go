@@ -0,0 +1,83 @@
+package Simap
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+var netrc1 = `machine imap.example.com login alice password alicepw
+machine imap.example.com
+	login bob
+	password bobpw
+
+macdef init
+machine imap.example.com login carol password macro
+
+machine other.example.com login carol password otherpw
+default login carol password defaultpw
+`
+
+func Test_netrcLookup(t *testing.T) {
+	tests := []struct {
+		machine, login, expected string
+	}{
+		{"imap.example.com", "alice", "alicepw"},
+		{"imap.example.com", "bob", "bobpw"},
+		{"imap.example.com", "carol", "defaultpw"},
+		{"other.example.com", "carol", "otherpw"},
+	}
+	for _, test := range tests {
+		pass, found := netrcLookup(netrc1, test.machine, test.login)
+		if !found || pass != test.expected {
+			t.Errorf("%s@%s should have password %q, got %q", test.login, test.machine, test.expected, pass)
+		}
+	}
+	if _, found := netrcLookup(netrc1, "other.example.com", "dave"); found {
+		t.Errorf("dave@other.example.com should not be found")
+	}
+}
+
+func Test_FileCredentials(t *testing.T) {
+	if filepath.Separator == '\\' {
+		t.Skip("file permissions are not checked on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(path, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	acct := &IMAPAccount{Username: "alice", Credentials: FileCredentials{path}}
+	pass, err := acct.password()
+	expectPassword(t, pass, err, "secret", "password file")
+
+	os.Chmod(path, 0644)
+	if _, err = acct.password(); err == nil {
+		t.Errorf("world readable password file should be refused")
+	}
+}
+
+func Test_CommandCredentials(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell")
+	}
+	acct := &IMAPAccount{Username: "alice", Server: &IMAPServer{Host: "imap.example.com", Port: 993}}
+
+	acct.Credentials = CommandCredentials{"sh", []string{"-c", "echo secret"}}
+	pass, err := acct.password()
+	expectPassword(t, pass, err, "secret", "plain output")
+
+	acct.Credentials = CommandCredentials{"sh", []string{"-c", `grep host= | sed 's/host=/password=pw-/'`}}
+	pass, err = acct.password()
+	expectPassword(t, pass, err, "pw-imap.example.com", "key=value output")
+}
+
+func expectPassword(t *testing.T, pass string, err error, expected string, label string) {
+	if err != nil {
+		t.Fatalf("%s has non-nil error: %s\n", label, err)
+	}
+	if pass != expected {
+		t.Errorf("%s should give password '%s', got '%s'", label, expected, pass)
+	}
+}
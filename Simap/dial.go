@@ -0,0 +1,219 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+)
+
+//Security is the way a connection to the IMAP server is secured.
+type Security int
+
+const (
+	//SecurityTLS uses implicit TLS, usually on port 993.
+	SecurityTLS Security = iota
+	//SecurityStartTLS connects in plaintext, usually on port 143, and requires STARTTLS.
+	SecurityStartTLS
+	//SecurityStartTLSOptional uses STARTTLS if the server advertises it and stays in plaintext otherwise.
+	SecurityStartTLSOptional
+	//SecurityNone never encrypts the connection. It is only allowed to loopback addresses.
+	SecurityNone
+)
+
+var securityNames = []string{"tls", "starttls", "starttls-optional", "none"}
+
+func (sec Security) String() string {
+	if sec < 0 || int(sec) >= len(securityNames) {
+		return fmt.Sprintf("Security(%d)", int(sec))
+	}
+	return securityNames[sec]
+}
+
+//ParseSecurity parses the names returned by Security.String,
+//"tls", "starttls", "starttls-optional" and "none".
+func ParseSecurity(name string) (sec Security, err error) {
+	for i, n := range securityNames {
+		if strings.EqualFold(n, name) {
+			sec = Security(i)
+			return
+		}
+	}
+	err = fmt.Errorf("Unknown security mode %q", name)
+	return
+}
+
+//TLSOptions configures the TLS connection to an IMAP server.
+type TLSOptions struct {
+	//RootCAs are the CAs trusted to sign the server certificate. The system pool is used if nil.
+	RootCAs *x509.CertPool
+	//Certificates are presented to servers which require TLS client authentication.
+	Certificates []tls.Certificate
+	//MinVersion is the minimum TLS version accepted, e.g. tls.VersionTLS13. The crypto/tls default is used if zero.
+	MinVersion uint16
+	//PinSHA256 if not empty is the base64 encoded SHA-256 hash of the SubjectPublicKeyInfo
+	//the server certificate must have. It is checked even if verification is skipped,
+	//so it can be used to trust a single self signed certificate.
+	PinSHA256 string
+}
+
+//LoadCAFile reads a file of PEM encoded CA certificates into a pool for TLSOptions.RootCAs.
+func LoadCAFile(path string) (pool *x509.CertPool, err error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		pool = nil
+		err = fmt.Errorf("No certificates found in %s", path)
+	}
+	return
+}
+
+//SPKIPin returns the base64 encoded SHA-256 hash of the SubjectPublicKeyInfo of cert,
+//the format of TLSOptions.PinSHA256.
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+//ErrInsecureAuth is returned when credentials would be sent over a connection which is not encrypted
+//and IMAPServer.AllowInsecureAuth is false.
+var ErrInsecureAuth = errors.New("Refusing to send credentials over an unencrypted connection")
+
+//greetingTimeout is how long Dial waits for the greeting of the IMAP server.
+const greetingTimeout = 30 * time.Second
+
+//Dial dials a connection to the IMAP server
+//If skipCerti is true then it will not check for the validity of the Certificate of the IMAP server,
+//good only if IMAP server is using self signed certi.
+func Dial(server *IMAPServer, skipCerti bool) (c *imap.Client, err error) {
+	return DialContext(context.Background(), server, skipCerti)
+}
+
+//DialContext is like Dial but gives up when ctx is done.
+func DialContext(ctx context.Context, server *IMAPServer, skipCerti bool) (c *imap.Client, err error) {
+	c, _, _, err = dial(ctx, server, skipCerti, nil)
+	return
+}
+
+//dial connects to server as required by server.Security.
+//It also returns the underlying connection of the client, closing it interrupts any blocked command,
+//and whether the connection is encrypted.
+//If wrap is not nil the TCP connection is passed through it.
+func dial(ctx context.Context, server *IMAPServer, skipCerti bool, wrap func(net.Conn) net.Conn) (c *imap.Client, conn net.Conn, secure bool, err error) {
+
+	if server.Security == SecurityNone && !isLoopback(server.Host) {
+		err = fmt.Errorf("Security mode none is only allowed to loopback addresses, not %q", server.Host)
+		return
+	}
+
+	addr := fmt.Sprintf("%s:%d", server.Host, server.Port)
+	var d net.Dialer
+	conn, err = d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return
+	}
+	if wrap != nil {
+		conn = wrap(conn)
+	}
+	config, err := tlsConfig(server, skipCerti)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	if server.Security == SecurityTLS {
+		tlsConn := tls.Client(conn, config)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return
+		}
+		conn = tlsConn
+		secure = true
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer func() {
+		if !stop() {
+			err = ctx.Err()
+		}
+		if err != nil {
+			conn.Close()
+			c = nil
+		}
+	}()
+
+	c, err = imap.NewClient(conn, server.Host, greetingTimeout)
+	if err != nil || secure {
+		return
+	}
+
+	switch server.Security {
+	case SecurityStartTLS:
+		if !c.Caps["STARTTLS"] {
+			err = errors.New("Server does not support STARTTLS")
+			return
+		}
+	case SecurityStartTLSOptional:
+		if !c.Caps["STARTTLS"] {
+			return
+		}
+	default:
+		return
+	}
+	err = WaitResp(c.StartTLS(config))
+	secure = err == nil
+	return
+}
+
+//tlsConfig builds the tls.Config for server from server.TLS.
+func tlsConfig(server *IMAPServer, skipCerti bool) (config *tls.Config, err error) {
+	config = &tls.Config{
+		InsecureSkipVerify: skipCerti,
+		ServerName:         server.Host,
+	}
+	opts := server.TLS
+	if opts == nil {
+		return
+	}
+	config.RootCAs = opts.RootCAs
+	config.Certificates = opts.Certificates
+	config.MinVersion = opts.MinVersion
+	if opts.PinSHA256 != "" {
+		pin, errD := base64.StdEncoding.DecodeString(opts.PinSHA256)
+		if errD != nil || len(pin) != sha256.Size {
+			err = fmt.Errorf("Invalid SHA-256 pin %q", opts.PinSHA256)
+			return
+		}
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("Server presented no certificate")
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+			if !bytes.Equal(sum[:], pin) {
+				return fmt.Errorf("Server certificate of %s does not match the pinned key", server.Host)
+			}
+			return nil
+		}
+	}
+	return
+}
+
+//isLoopback reports whether host is localhost or a loopback IP address.
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,83 @@
+package Simap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func Test_ParseSecurity(t *testing.T) {
+	for _, sec := range []Security{SecurityTLS, SecurityStartTLS, SecurityStartTLSOptional, SecurityNone} {
+		parsed, err := ParseSecurity(sec.String())
+		if err != nil || parsed != sec {
+			t.Errorf("ParseSecurity(%q) = %v, %v", sec.String(), parsed, err)
+		}
+	}
+	if _, err := ParseSecurity("ssl"); err == nil {
+		t.Errorf("ssl should not be a valid security mode")
+	}
+}
+
+func Test_isLoopback(t *testing.T) {
+	for host, expected := range map[string]bool{
+		"localhost":      true,
+		"127.0.0.1":      true,
+		"::1":            true,
+		"10.0.0.1":       false,
+		"imap.gmail.com": false,
+	} {
+		if isLoopback(host) != expected {
+			t.Errorf("isLoopback(%q) should be %v", host, expected)
+		}
+	}
+}
+
+func Test_tlsConfigPin(t *testing.T) {
+	cert := selfSignedCert(t)
+	other := selfSignedCert(t)
+	server := &IMAPServer{Host: "imap.example.com", Port: 993, TLS: &TLSOptions{PinSHA256: SPKIPin(cert)}}
+
+	config, err := tlsConfig(server, true)
+	if err != nil {
+		t.Fatalf("tlsConfig: %s", err)
+	}
+	if err = config.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}); err != nil {
+		t.Errorf("pinned certificate should be accepted, got %s", err)
+	}
+	if err = config.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{other}}); err == nil {
+		t.Errorf("certificate with another key should be rejected")
+	}
+
+	server.TLS.PinSHA256 = "not base64"
+	if _, err = tlsConfig(server, false); err == nil {
+		t.Errorf("invalid pin should be an error")
+	}
+}
+
+func selfSignedCert(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "imap.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
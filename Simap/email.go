@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"mime"
 	"mime/multipart"
 	"net/mail"
@@ -84,7 +83,7 @@ func parseMultipart(r io.Reader, boundary string, mimetype string) (body io.Read
 		if strings.HasPrefix(partType, "multipart/") {
 			body, err = parseMultipart(part, partParams["boundary"], mimetype)
 			if err != nil {
-				log.Printf("in boundary %q, returning error for multipart child %q: %v", boundary, partParams["boundary"], err)
+				err = fmt.Errorf("in boundary %q, multipart child %q: %w", boundary, partParams["boundary"], err)
 				return
 			}
 			continue
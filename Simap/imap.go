@@ -3,30 +3,78 @@
 //--Creates,Deletes Mboxes/Folders on the Server.
 //--Marks,Unmarks Imap Flags from the mails.
 //--Can Skip Certificate Verification of the IMAP Server. (Good for IMAP servers using SelfSigned Cerificates.)
+//--Trusts custom CAs, presents client certificates and pins server keys.
+//--Streams fetched emails one at a time in constant memory.
+//--Spreads bulk operations over several connections.
+//--Reuses a single logged in connection for many operations through Session.
+//--Logs through any Logger such as *slog.Logger and stays silent by default.
+//--Reports connects, logins, commands, bytes and batch latency to an Observer, with a Prometheus collector.
+//--Reconnects and resumes from the unfinished batch after transient failures, with backoff.
+//--Moves with UID MOVE or UID EXPUNGE when the server supports them.
+//--Expunges only the given UIDs and maps copied UIDs to their new UIDs with UIDPLUS.
+//--Appends messages to mailboxes and returns their UID with UIDPLUS.
+//--Lists mailboxes with their hierarchy delimiter, attributes and subscription state.
+//--Finds the Sent, Trash, Junk, Drafts and Archive mailboxes with SPECIAL-USE, XLIST or their usual names.
+//--Takes and returns mailbox names in UTF-8, sending them in modified UTF-7.
+//--Gets message counts, UIDNEXT, UIDVALIDITY, HIGHESTMODSEQ and size of mailboxes with STATUS.
+//--Renames mailboxes, deletes whole mailbox trees and creates missing parent folders.
+//--Subscribes and unsubscribes mailboxes and reconciles subscriptions with the existing mailboxes.
+//--Watches mailboxes for new, expunged and flagged messages with IDLE or NOOP polling.
+//--Syncs only the new mails of a mailbox using UIDVALIDITY and UID checkpoints kept in a pluggable store.
+//--Fetches flag changes and expunged mails since a mod-sequence with CONDSTORE/QRESYNC, and stores flags only on mails unchanged since then.
 package Simap
 
 import "code.google.com/p/go-imap/go1/imap"
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net/mail"
-	"os"
 	"time"
 )
 
 type IMAPServer struct {
 	Host string
 	Port uint16
+	//Security is how the connection is secured, implicit TLS by default.
+	Security Security
+	//AllowInsecureAuth allows sending credentials over a connection which is not encrypted.
+	AllowInsecureAuth bool
+	//TLS configures certificate verification and client certificates, nil means the defaults.
+	TLS *TLSOptions
 }
 
 type IMAPAccount struct {
 	Username string
 	Password string
 	Server   *IMAPServer
+	//Credentials if not nil supplies the password at login time when Password is empty.
+	Credentials CredentialProvider
+	//TokenSource if not nil is used to log in with XOAUTH2 or OAUTHBEARER instead of Password.
+	TokenSource TokenSource
+	//Mechanism if not empty is the only authentication mechanism used, e.g. "PLAIN" or "LOGIN".
+	//Otherwise the strongest of Mechanisms supported by the server is negotiated.
+	Mechanism string
+	//Options tunes how operations on the account are run, nil means the defaults.
+	Options *Options
+}
+
+//Options tunes how operations on an account are run.
+type Options struct {
+	//Workers is the number of connections the jobs of an operation are spread over.
+	//0 or 1 runs all jobs one after the other on the connection of the Session.
+	Workers int
+	//Unordered delivers fetched Emails as soon as their job finishes instead of in job order.
+	//It only matters with more than one worker.
+	Unordered bool
+	//Logger receives the log output of operations on the account, nil discards it.
+	Logger Logger
+	//Observer receives events for dashboards and metrics, see Metrics. nil means no events.
+	Observer Observer
+	//Retry if not nil retries the jobs of operations after transient failures such as a dropped connection.
+	Retry *RetryPolicy
 }
 
 type UIDFetchJob struct {
@@ -44,552 +92,392 @@ type MsgData struct {
 	Header   mail.Header
 }
 
+//pollInterval is the longest time a receive blocks before the context is checked again.
+const pollInterval = 250 * time.Millisecond
+
+//WaitResp waits for cmd to complete. It returns an error if cmd could not be sent
+//or did not complete with OK status.
 func WaitResp(cmd *imap.Command, err error) error {
-	if err == nil {
-		for cmd.InProgress() {
-			cmd.Client().Recv(-1)
-			for _, rsp := range cmd.Data {
-				log.Println(cmd.Name(true), " Response:", rsp.String())
+	return WaitRespContext(context.Background(), cmd, err)
+}
+
+//WaitRespContext is like WaitResp but gives up waiting and returns ctx.Err() when ctx is done.
+//The command is still in progress in that case and the client should be logged out.
+func WaitRespContext(ctx context.Context, cmd *imap.Command, err error) error {
+	_, err = waitResp(ctx, cmd, err, nopLogger{}, nil)
+	return err
+}
+
+//waitResp is WaitRespContext logging the responses of cmd to l and passing them to data if not nil.
+//It also returns the tagged response completing cmd.
+func waitResp(ctx context.Context, cmd *imap.Command, err error, l Logger, data func(rsp *imap.Response)) (rsp *imap.Response, err1 error) {
+	if err != nil {
+		return nil, err
+	}
+	for cmd.InProgress() {
+		if err = recv(ctx, cmd.Client()); err != nil {
+			return nil, err
+		}
+		for _, rsp := range cmd.Data {
+			l.Debug("Response", "command", cmd.Name(true), "response", rsp.String())
+			if data != nil {
+				data(rsp)
 			}
-			cmd.Data = nil
+		}
+		cmd.Data = nil
+	}
+	return cmd.Result(imap.OK)
+}
+
+//recv receives the next response from the server, checking ctx every pollInterval.
+func recv(ctx context.Context, c *imap.Client) (err error) {
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		err = c.Recv(pollInterval)
+		if err != imap.ErrTimeout {
+			return
 		}
 	}
-	return err
 }
 
-//CreateMbox creates a mailbox/folder on the server
+//CreateMbox creates a mailbox/folder on the server along with its missing parent folders.
 //If already exists then do nothing
 //IF skipCerti is true then it will not check for the validity of the Certificate of the IMAP server,
 //good only if IMAP server is using self signed certi.
 func CreateMbox(acct *IMAPAccount, name string, skipCerti bool) (err error) {
+	return CreateMboxContext(context.Background(), acct, name, skipCerti)
+}
 
-	c, errD := Dial(acct.Server, skipCerti)
-	if errD != nil {
-		err = errD
-		return
-	}
-	_, err = login(c, acct.Username, acct.Password)
-	if err != nil {
-		return
-	}
+//CreateMboxContext is like CreateMbox but gives up when ctx is done.
+func CreateMboxContext(ctx context.Context, acct *IMAPAccount, name string, skipCerti bool) (err error) {
+	return createMbox(ctx, acct, name, false, skipCerti)
+}
 
-	defer c.Logout(-1)
+//CreateMboxSubscribed is like CreateMbox but also subscribes the mailboxes it creates, so that mail clients show them.
+func CreateMboxSubscribed(acct *IMAPAccount, name string, skipCerti bool) (err error) {
+	return CreateMboxSubscribedContext(context.Background(), acct, name, skipCerti)
+}
 
-	err = WaitResp(c.Select(name, false))
-	if err != nil { //Doesnt Exist->Create
-		err = WaitResp(c.Create(name))
-		if err != nil {
-			return
-		}
-		err = WaitResp(c.Select(name, false))
+//CreateMboxSubscribedContext is like CreateMboxSubscribed but gives up when ctx is done.
+func CreateMboxSubscribedContext(ctx context.Context, acct *IMAPAccount, name string, skipCerti bool) (err error) {
+	return createMbox(ctx, acct, name, true, skipCerti)
+}
+
+func createMbox(ctx context.Context, acct *IMAPAccount, name string, subscribe bool, skipCerti bool) (err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
+	if err != nil {
+		return
 	}
-	err = WaitResp(c.Close(false))
-	return
+	defer s.Logout()
+	return s.CreateMbox(ctx, name, subscribe)
 }
 
 //DeleteMbox deletes a mailbox/folder on the server
 //If does not exist then do nothing
+//The mailboxes below it are left alone, see DeleteMboxTree.
 func DeleteMbox(acct *IMAPAccount, name string, skipCerti bool) (err error) {
+	return DeleteMboxContext(context.Background(), acct, name, skipCerti)
+}
 
-	c, errD := Dial(acct.Server, skipCerti)
-	if errD != nil {
-		err = errD
-		return
-	}
-	_, err = login(c, acct.Username, acct.Password)
+//DeleteMboxContext is like DeleteMbox but gives up when ctx is done.
+func DeleteMboxContext(ctx context.Context, acct *IMAPAccount, name string, skipCerti bool) (err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
+	defer s.Logout()
+	return s.DeleteMbox(ctx, name)
+}
 
-	defer c.Logout(-1)
+//Subscribe adds mailbox name to the subscribed mailboxes of acct, which most mail clients show.
+func Subscribe(acct *IMAPAccount, name string, skipCerti bool) (err error) {
+	return SubscribeContext(context.Background(), acct, name, skipCerti)
+}
 
-	err = WaitResp(c.Select(name, false))
-	if err != nil { //Doesnt Exist,Return
-		return
-	}
-	err = WaitResp(c.Close(false))
+//SubscribeContext is like Subscribe but gives up when ctx is done.
+func SubscribeContext(ctx context.Context, acct *IMAPAccount, name string, skipCerti bool) (err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
-	err = WaitResp(c.Delete(name))
-	return
+	defer s.Logout()
+	return s.Subscribe(ctx, name)
 }
 
-//CopyEmails copies Emails having unique identifiers uids (NOT sequence numbers) of mailbox src
-//to mailbox dst by making bunches of jobsize.
-//If dst mbox doesnt exist then it will create it.
-//IF skipCerti is true then it will not check for the validity of the Certificate of the IMAP server,
-//good only if IMAP server is using self signed certi.
-//e.g. if jobsize =10 and total emails =100 then it will create 10 bunches of size 10 and then copy them.
-func CopyEmails(acct *IMAPAccount, src string, dst string, uids []uint32, jobSize int, skipCerti bool) (err error) {
-
-	imap.DefaultLogger = log.New(os.Stdout, "", 0)
-	//	imap.DefaultLogMask = imap.LogConn | imap.LogRaw
-
-	log.Printf("Starting Copying for user '%s' on IMAP server '%s:%d'", acct.Username, acct.Server.Host, acct.Server.Port)
-
-	if jobSize <= 0 {
-		jobSize = 10
-	}
+//Unsubscribe removes mailbox name from the subscribed mailboxes of acct.
+func Unsubscribe(acct *IMAPAccount, name string, skipCerti bool) (err error) {
+	return UnsubscribeContext(context.Background(), acct, name, skipCerti)
+}
 
-	// Fetch UIDs.
-	c, errD := Dial(acct.Server, skipCerti)
-	if errD != nil {
-		err = errD
-		return
-	}
-	_, err = login(c, acct.Username, acct.Password)
+//UnsubscribeContext is like Unsubscribe but gives up when ctx is done.
+func UnsubscribeContext(ctx context.Context, acct *IMAPAccount, name string, skipCerti bool) (err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
+	defer s.Logout()
+	return s.Unsubscribe(ctx, name)
+}
 
-	defer c.Logout(-1)
-
-	if src == "" {
-		err = errors.New("No source provided")
-		return
-	}
-	if dst == "" {
-		err = errors.New("No Dst provided")
-		return
-	}
+//ReconcileSubscriptions unsubscribes the subscribed mailboxes of acct which do not exist anymore
+//and, if subscribeAll is true, subscribes all its mailboxes which are not subscribed.
+func ReconcileSubscriptions(acct *IMAPAccount, subscribeAll bool, skipCerti bool) (added []string, removed []string, err error) {
+	return ReconcileSubscriptionsContext(context.Background(), acct, subscribeAll, skipCerti)
+}
 
-	//PRC Dest MBOX CHeck Start
-	err = WaitResp(c.Select(dst, false))
-	if err != nil { //Doesnt Exist->Create
-		err = WaitResp(c.Create(dst))
-		if err != nil {
-			return
-		}
-		err = WaitResp(c.Select(dst, false))
-	}
-	err = WaitResp(c.Close(false))
+//ReconcileSubscriptionsContext is like ReconcileSubscriptions but gives up when ctx is done.
+func ReconcileSubscriptionsContext(ctx context.Context, acct *IMAPAccount, subscribeAll bool, skipCerti bool) (added []string, removed []string, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
-	//PRC Dest MBOX Check End
+	defer s.Logout()
+	return s.ReconcileSubscriptions(ctx, subscribeAll)
+}
 
-	err = WaitResp(c.Select(src, true))
+//RenameMbox renames mailbox oldName to newName, along with the mailboxes below it.
+//Missing parent folders of newName are created.
+func RenameMbox(acct *IMAPAccount, oldName string, newName string, skipCerti bool) (err error) {
+	return RenameMboxContext(context.Background(), acct, oldName, newName, skipCerti)
+}
+
+//RenameMboxContext is like RenameMbox but gives up when ctx is done.
+func RenameMboxContext(ctx context.Context, acct *IMAPAccount, oldName string, newName string, skipCerti bool) (err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
-
-	timestarted := time.Now()
-
-	var jobs []*imap.SeqSet
-
-	var jUids []uint32
-	for i := 0; i < len(uids); i++ {
-		/*Logic
-		1.If we are at last index len(uids)-1 and still have not reached jobSize limit then append that to jobs
-			(In other words if set size is smaller then jobsize)
-		2.if we go over index of size greater then jobsize then add all elemetns up to that index in to jobs
-		3.0 mod n returns 0 hence i!=0 is checked
-
-		*/
-		if i%(jobSize) == 0 && i != 0 { //Append the new job to jobs
-			set, _ := imap.NewSeqSet("")
-			set.AddNum(jUids[:]...)
-			jobs = append(jobs, set)
-			jUids = nil
-		}
-		jUids = append(jUids, uids[i])
-		if i == len(uids)-1 { //Last Element Encountered Add to jobs
-			set, _ := imap.NewSeqSet("")
-			set.AddNum(jUids[:]...)
-			jobs = append(jobs, set)
-			jUids = nil
-		}
-	}
-
-	log.Printf("Copying: %d UIDs total, %d jobs of size <= %d to %s\n", len(uids), len(jobs), jobSize, dst)
-
-	for _, jobUIDs := range jobs {
-		log.Println("Copying ", jobUIDs)
-		err1 := WaitResp(c.UIDCopy(jobUIDs, dst))
-		if err1 != nil {
-			log.Println(err)
-			continue
-		}
-
-	}
-	err = WaitResp(c.Close(false))
-	timeelapsed := time.Since(timestarted)
-	msecpermessage := timeelapsed.Seconds() / float64(len(uids)) * 1000
-	messagespersec := float64(len(uids)) / timeelapsed.Seconds()
-	log.Printf("Finished copying %d messages in %.2fs (%.1fms per message; %.1f messages per second)\n", len(uids), timeelapsed.Seconds(), msecpermessage, messagespersec)
-
-	return
-
+	defer s.Logout()
+	return s.RenameMbox(ctx, oldName, newName)
 }
 
-//MoveEmails is similar to CopyEmails but it moves the mails to dst hence deleting mails from src.
-func MoveEmails(acct *IMAPAccount, src string, dst string, uids []uint32, jobSize int, skipCerti bool) (err error) {
-
-	imap.DefaultLogger = log.New(os.Stdout, "", 0)
-	//	imap.DefaultLogMask = imap.LogConn | imap.LogRaw
-
-	log.Printf("Starting Moving for user '%s' on IMAP server '%s:%d'", acct.Username, acct.Server.Host, acct.Server.Port)
-
-	if jobSize <= 0 {
-		jobSize = 10
-	}
+//DeleteMboxTree deletes mailbox name along with all the mailboxes below it.
+//If moveTo is not "" the messages of all these mailboxes are first moved to mailbox moveTo.
+func DeleteMboxTree(acct *IMAPAccount, name string, moveTo string, skipCerti bool) (err error) {
+	return DeleteMboxTreeContext(context.Background(), acct, name, moveTo, skipCerti)
+}
 
-	// Fetch UIDs.
-	c, errD := Dial(acct.Server, skipCerti)
-	if errD != nil {
-		err = errD
-		return
-	}
-	_, err = login(c, acct.Username, acct.Password)
+//DeleteMboxTreeContext is like DeleteMboxTree but gives up when ctx is done.
+func DeleteMboxTreeContext(ctx context.Context, acct *IMAPAccount, name string, moveTo string, skipCerti bool) (err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
+	defer s.Logout()
+	return s.DeleteMboxTree(ctx, name, moveTo)
+}
 
-	defer c.Logout(-1)
-
-	if src == "" {
-		err = errors.New("No source provided")
-		return
-	}
-	if dst == "" {
-		err = errors.New("No Dst provided")
-		return
-	}
+//ListMailboxes lists the mailboxes matching pattern relative to reference ref,
+//e.g. ListMailboxes(acct, "", "*", false) lists all mailboxes of acct.
+func ListMailboxes(acct *IMAPAccount, ref string, pattern string, skipCerti bool) (mboxes []MboxInfo, err error) {
+	return ListMailboxesContext(context.Background(), acct, ref, pattern, skipCerti)
+}
 
-	//PRC Dest MBOX CHeck Start
-	err = WaitResp(c.Select(dst, false))
-	if err != nil { //Doesnt Exist->Create
-		err = WaitResp(c.Create(dst))
-		if err != nil {
-			return
-		}
-		err = WaitResp(c.Select(dst, false))
-	}
-	err = WaitResp(c.Close(false))
+//ListMailboxesContext is like ListMailboxes but gives up when ctx is done.
+func ListMailboxesContext(ctx context.Context, acct *IMAPAccount, ref string, pattern string, skipCerti bool) (mboxes []MboxInfo, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
-	//PRC Dest MBOX Check End
+	defer s.Logout()
+	return s.ListMailboxes(ctx, ref, pattern)
+}
 
-	err = WaitResp(c.Select(src, false))
+//SpecialMailboxes finds the mailboxes of acct by role, e.g. the one of SpecialTrash.
+func SpecialMailboxes(acct *IMAPAccount, skipCerti bool) (roles map[SpecialUse]string, err error) {
+	return SpecialMailboxesContext(context.Background(), acct, skipCerti)
+}
+
+//SpecialMailboxesContext is like SpecialMailboxes but gives up when ctx is done.
+func SpecialMailboxesContext(ctx context.Context, acct *IMAPAccount, skipCerti bool) (roles map[SpecialUse]string, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
+	defer s.Logout()
+	return s.SpecialMailboxes(ctx)
+}
 
-	timestarted := time.Now()
-
-	var jobs []*imap.SeqSet
-
-	var jUids []uint32
-	for i := 0; i < len(uids); i++ {
-
-		if i%(jobSize) == 0 && i != 0 { //Append the new job to jobs
-			set, _ := imap.NewSeqSet("")
-			set.AddNum(jUids[:]...)
-			jobs = append(jobs, set)
-			jUids = nil
-		}
-		jUids = append(jUids, uids[i])
-		if i == len(uids)-1 { //Last Element Encountered Add to jobs
-			set, _ := imap.NewSeqSet("")
-			set.AddNum(jUids[:]...)
-			jobs = append(jobs, set)
-			jUids = nil
-		}
-	}
-
-	log.Printf("Moving: %d UIDs total, %d jobs of size <= %d to %s\n", len(uids), len(jobs), jobSize, dst)
-
-	for _, jobUIDs := range jobs {
-		log.Println("Moving ", jobUIDs)
-		err1 := WaitResp(c.UIDCopy(jobUIDs, dst))
-		if err1 != nil {
-			log.Println(err)
-			continue
-		}
-
-		err = WaitResp(c.UIDStore(jobUIDs, "+FLAGS.SILENT", imap.NewFlagSet(`\Deleted`)))
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-
-		err = WaitResp(c.Expunge(jobUIDs))
-
-		if err != nil {
-			log.Println("Expunge:", err)
-			continue
-		}
+//MailboxStatus returns the message counts, UIDNEXT and UIDVALIDITY of each of the mailboxes names without selecting them.
+func MailboxStatus(acct *IMAPAccount, names []string, skipCerti bool) (statuses []MboxStatus, err error) {
+	return MailboxStatusContext(context.Background(), acct, names, skipCerti)
+}
 
-	}
-	err = WaitResp(c.Close(false))
+//MailboxStatusContext is like MailboxStatus but gives up when ctx is done.
+func MailboxStatusContext(ctx context.Context, acct *IMAPAccount, names []string, skipCerti bool) (statuses []MboxStatus, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
-		log.Println("Error While Closing ", err)
 		return
 	}
-	timeelapsed := time.Since(timestarted)
-	msecpermessage := timeelapsed.Seconds() / float64(len(uids)) * 1000
-	messagespersec := float64(len(uids)) / timeelapsed.Seconds()
-	log.Printf("Finished Moving %d messages in %.2fs (%.1fms per message; %.1f messages per second)\n", len(uids), timeelapsed.Seconds(), msecpermessage, messagespersec)
-
-	return
-
+	defer s.Logout()
+	return s.MailboxStatus(ctx, names...)
 }
 
-//DeleteEMails deletes mails having uids from src.Arguments have same meaning as CopyEmails
-func DeleteEmails(acct *IMAPAccount, src string, uids []uint32, jobSize int, skipCerti bool) (err error) {
-
-	imap.DefaultLogger = log.New(os.Stdout, "", 0)
-	//	imap.DefaultLogMask = imap.LogConn | imap.LogRaw
-
-	log.Printf("Starting Deleting for user '%s' on IMAP server '%s:%d'", acct.Username, acct.Server.Host, acct.Server.Port)
-
-	if jobSize <= 0 {
-		jobSize = 10
-	}
+//Watch calls handler for each change the server reports in mailbox mbox of acct, such as new messages,
+//until handler returns an error. See Session.Watch.
+func Watch(acct *IMAPAccount, mbox string, handler func(WatchEvent) error, skipCerti bool) (err error) {
+	return WatchContext(context.Background(), acct, mbox, handler, skipCerti)
+}
 
-	c, errD := Dial(acct.Server, skipCerti)
-	if errD != nil {
-		err = errD
-		return
-	}
-	_, err = login(c, acct.Username, acct.Password)
+//WatchContext is like Watch but also stops when ctx is done.
+func WatchContext(ctx context.Context, acct *IMAPAccount, mbox string, handler func(WatchEvent) error, skipCerti bool) (err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
+	defer s.Logout()
+	return s.Watch(ctx, mbox, handler)
+}
 
-	defer c.Logout(-1)
-
-	if src == "" {
-		err = errors.New("No source provided")
-		return
-	}
+//CopyEmails copies Emails having unique identifiers uids (NOT sequence numbers) of mailbox src
+//to mailbox dst by making bunches of jobsize.
+//If dst mbox doesnt exist then it will create it.
+//res lists the UIDs which were copied and those which failed with their errors,
+//err is a *BatchError if any failed.
+//IF skipCerti is true then it will not check for the validity of the Certificate of the IMAP server,
+//good only if IMAP server is using self signed certi.
+//e.g. if jobsize =10 and total emails =100 then it will create 10 bunches of size 10 and then copy them.
+func CopyEmails(acct *IMAPAccount, src string, dst string, uids []uint32, jobSize int, skipCerti bool) (res *Result, err error) {
+	return CopyEmailsContext(context.Background(), acct, src, dst, uids, jobSize, skipCerti)
+}
 
-	err = WaitResp(c.Select(src, false))
+//CopyEmailsContext is like CopyEmails but gives up when ctx is done.
+func CopyEmailsContext(ctx context.Context, acct *IMAPAccount, src string, dst string, uids []uint32, jobSize int, skipCerti bool) (res *Result, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
+	defer s.Logout()
+	return s.CopyEmails(ctx, src, dst, uids, jobSize)
+}
 
-	timestarted := time.Now()
-
-	var jobs []*imap.SeqSet
-
-	var jUids []uint32
-	for i := 0; i < len(uids); i++ {
+//MoveEmails is similar to CopyEmails but it moves the mails to dst hence deleting mails from src.
+func MoveEmails(acct *IMAPAccount, src string, dst string, uids []uint32, jobSize int, skipCerti bool) (res *Result, err error) {
+	return MoveEmailsContext(context.Background(), acct, src, dst, uids, jobSize, skipCerti)
+}
 
-		if i%(jobSize) == 0 && i != 0 { //Append the new job to jobs
-			set, _ := imap.NewSeqSet("")
-			set.AddNum(jUids[:]...)
-			jobs = append(jobs, set)
-			jUids = nil
-		}
-		jUids = append(jUids, uids[i])
-		if i == len(uids)-1 { //Last Element Encountered Add to jobs
-			set, _ := imap.NewSeqSet("")
-			set.AddNum(jUids[:]...)
-			jobs = append(jobs, set)
-			jUids = nil
-		}
+//MoveEmailsContext is like MoveEmails but gives up when ctx is done.
+func MoveEmailsContext(ctx context.Context, acct *IMAPAccount, src string, dst string, uids []uint32, jobSize int, skipCerti bool) (res *Result, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
+	if err != nil {
+		return
 	}
+	defer s.Logout()
+	return s.MoveEmails(ctx, src, dst, uids, jobSize)
+}
 
-	log.Printf("Deleting: %d UIDs total, %d jobs of size <= %d from %s\n", len(uids), len(jobs), jobSize, src)
-
-	for _, jobUIDs := range jobs {
-		log.Println("Deleting ", jobUIDs)
-
-		err = WaitResp(c.UIDStore(jobUIDs, "+FLAGS.SILENT", imap.NewFlagSet(`\Deleted`)))
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-
-		err = WaitResp(c.Expunge(jobUIDs))
-
-		if err != nil {
-			log.Println("Expunge:", err)
-			continue
-		}
+//DeleteEMails deletes mails having uids from src.Arguments have same meaning as CopyEmails
+func DeleteEmails(acct *IMAPAccount, src string, uids []uint32, jobSize int, skipCerti bool) (res *Result, err error) {
+	return DeleteEmailsContext(context.Background(), acct, src, uids, jobSize, skipCerti)
+}
 
-	}
-	err = WaitResp(c.Close(false))
+//DeleteEmailsContext is like DeleteEmails but gives up when ctx is done.
+func DeleteEmailsContext(ctx context.Context, acct *IMAPAccount, src string, uids []uint32, jobSize int, skipCerti bool) (res *Result, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
-		log.Println("Error While Closing ", err)
 		return
 	}
-	timeelapsed := time.Since(timestarted)
-	msecpermessage := timeelapsed.Seconds() / float64(len(uids)) * 1000
-	messagespersec := float64(len(uids)) / timeelapsed.Seconds()
-	log.Printf("Finished Deleting %d messages in %.2fs (%.1fms per message; %.1f messages per second)\n", len(uids), timeelapsed.Seconds(), msecpermessage, messagespersec)
-
-	return
-
+	defer s.Logout()
+	return s.DeleteEmails(ctx, src, uids, jobSize)
 }
 
 //MarkEmails marks mails having uids from src with IMAP flag specified in imapFlag.
 //See RFC 3501 section 2.3.2 for a list of all valid flags.
-func MarkEmails(acct *IMAPAccount, src string, imapFlag string, uids []uint32, jobSize int, skipCerti bool) (err error) {
-
-	imap.DefaultLogger = log.New(os.Stdout, "", 0)
-	//	imap.DefaultLogMask = imap.LogConn | imap.LogRaw
-
-	log.Printf("Starting Marking for user '%s' on IMAP server '%s:%d'", acct.Username, acct.Server.Host, acct.Server.Port)
-
-	if jobSize <= 0 {
-		jobSize = 10
-	}
+func MarkEmails(acct *IMAPAccount, src string, imapFlag string, uids []uint32, jobSize int, skipCerti bool) (res *Result, err error) {
+	return MarkEmailsContext(context.Background(), acct, src, imapFlag, uids, jobSize, skipCerti)
+}
 
-	c, errD := Dial(acct.Server, skipCerti)
-	if errD != nil {
-		err = errD
-		return
-	}
-	_, err = login(c, acct.Username, acct.Password)
+//MarkEmailsContext is like MarkEmails but gives up when ctx is done.
+func MarkEmailsContext(ctx context.Context, acct *IMAPAccount, src string, imapFlag string, uids []uint32, jobSize int, skipCerti bool) (res *Result, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
+	defer s.Logout()
+	return s.MarkEmails(ctx, src, imapFlag, uids, jobSize)
+}
 
-	defer c.Logout(-1)
-
-	if src == "" {
-		err = errors.New("No source provided")
-		return
-	}
+//UnmarkEmails unmarks/resets flags of mails having uids from src with IMAP flag specified in imapFlag.
+//See RFC 3501 section 2.3.2 for a list of all valid flags.
+func UnMarkEmails(acct *IMAPAccount, src string, imapFlag string, uids []uint32, jobSize int, skipCerti bool) (res *Result, err error) {
+	return UnMarkEmailsContext(context.Background(), acct, src, imapFlag, uids, jobSize, skipCerti)
+}
 
-	err = WaitResp(c.Select(src, false))
+//UnMarkEmailsContext is like UnMarkEmails but gives up when ctx is done.
+func UnMarkEmailsContext(ctx context.Context, acct *IMAPAccount, src string, imapFlag string, uids []uint32, jobSize int, skipCerti bool) (res *Result, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
+	defer s.Logout()
+	return s.UnMarkEmails(ctx, src, imapFlag, uids, jobSize)
+}
 
-	timestarted := time.Now()
-
-	var jobs []*imap.SeqSet
-
-	var jUids []uint32
-	for i := 0; i < len(uids); i++ {
-
-		if i%(jobSize) == 0 && i != 0 { //Append the new job to jobs
-			set, _ := imap.NewSeqSet("")
-			set.AddNum(jUids[:]...)
-			jobs = append(jobs, set)
-			jUids = nil
-		}
-		jUids = append(jUids, uids[i])
-		if i == len(uids)-1 { //Last Element Encountered Add to jobs
-			set, _ := imap.NewSeqSet("")
-			set.AddNum(jUids[:]...)
-			jobs = append(jobs, set)
-			jUids = nil
-		}
-	}
-
-	log.Printf("Marking: %d UIDs with %s total, %d jobs of size <= %d from %s\n", len(uids), imapFlag, len(jobs), jobSize, src)
-
-	for _, jobUIDs := range jobs {
-		log.Println("Marking ", jobUIDs)
-
-		err = WaitResp(c.UIDStore(jobUIDs, "+FLAGS.SILENT", imap.NewFlagSet(imapFlag)))
-		if err != nil {
-			log.Println(err)
-			continue
-		}
+//MarkEmailsUnchangedSince is like MarkEmails but leaves the mails whose flags changed since mod-sequence modSeq as they are.
+//See Session.MarkEmailsUnchangedSince.
+func MarkEmailsUnchangedSince(acct *IMAPAccount, src string, imapFlag string, uids []uint32, modSeq uint64, jobSize int, skipCerti bool) (res *Result, err error) {
+	return MarkEmailsUnchangedSinceContext(context.Background(), acct, src, imapFlag, uids, modSeq, jobSize, skipCerti)
+}
 
-	}
-	err = WaitResp(c.Close(false))
+//MarkEmailsUnchangedSinceContext is like MarkEmailsUnchangedSince but gives up when ctx is done.
+func MarkEmailsUnchangedSinceContext(ctx context.Context, acct *IMAPAccount, src string, imapFlag string, uids []uint32, modSeq uint64, jobSize int, skipCerti bool) (res *Result, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
-		log.Println("Error While Closing ", err)
 		return
 	}
-	timeelapsed := time.Since(timestarted)
-	msecpermessage := timeelapsed.Seconds() / float64(len(uids)) * 1000
-	messagespersec := float64(len(uids)) / timeelapsed.Seconds()
-	log.Printf("Finished Marking %d messages in %.2fs (%.1fms per message; %.1f messages per second)\n", len(uids), timeelapsed.Seconds(), msecpermessage, messagespersec)
-
-	return
-
+	defer s.Logout()
+	return s.MarkEmailsUnchangedSince(ctx, src, imapFlag, uids, modSeq, jobSize)
 }
 
-//UnmarkEmails unmarks/resets flags of mails having uids from src with IMAP flag specified in imapFlag.
-//See RFC 3501 section 2.3.2 for a list of all valid flags.
-func UnMarkEmails(acct *IMAPAccount, src string, imapFlag string, uids []uint32, jobSize int, skipCerti bool) (err error) {
-
-	imap.DefaultLogger = log.New(os.Stdout, "", 0)
-	//	imap.DefaultLogMask = imap.LogConn | imap.LogRaw
-
-	log.Printf("Starting UnMarking for user '%s' on IMAP server '%s:%d'", acct.Username, acct.Server.Host, acct.Server.Port)
-
-	if jobSize <= 0 {
-		jobSize = 10
-	}
+//UnMarkEmailsUnchangedSince is like UnMarkEmails but leaves the mails whose flags changed since mod-sequence modSeq as they are.
+//See Session.MarkEmailsUnchangedSince.
+func UnMarkEmailsUnchangedSince(acct *IMAPAccount, src string, imapFlag string, uids []uint32, modSeq uint64, jobSize int, skipCerti bool) (res *Result, err error) {
+	return UnMarkEmailsUnchangedSinceContext(context.Background(), acct, src, imapFlag, uids, modSeq, jobSize, skipCerti)
+}
 
-	c, errD := Dial(acct.Server, skipCerti)
-	if errD != nil {
-		err = errD
-		return
-	}
-	_, err = login(c, acct.Username, acct.Password)
+//UnMarkEmailsUnchangedSinceContext is like UnMarkEmailsUnchangedSince but gives up when ctx is done.
+func UnMarkEmailsUnchangedSinceContext(ctx context.Context, acct *IMAPAccount, src string, imapFlag string, uids []uint32, modSeq uint64, jobSize int, skipCerti bool) (res *Result, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
+	defer s.Logout()
+	return s.UnMarkEmailsUnchangedSince(ctx, src, imapFlag, uids, modSeq, jobSize)
+}
 
-	defer c.Logout(-1)
-
-	if src == "" {
-		err = errors.New("No source provided")
-		return
-	}
+//AppendMessage uploads msg, a raw RFC 5322 message, to mailbox mbox creating mbox if it does not exist.
+//flags such as `\Seen` or `\Draft` are set on the new message and date if not zero is its internal date.
+//uid is the UID of the new message if the server supports UIDPLUS, 0 otherwise.
+func AppendMessage(acct *IMAPAccount, mbox string, msg []byte, flags []string, date time.Time, skipCerti bool) (uid uint32, err error) {
+	return AppendMessageContext(context.Background(), acct, mbox, msg, flags, date, skipCerti)
+}
 
-	err = WaitResp(c.Select(src, false))
+//AppendMessageContext is like AppendMessage but gives up when ctx is done.
+func AppendMessageContext(ctx context.Context, acct *IMAPAccount, mbox string, msg []byte, flags []string, date time.Time, skipCerti bool) (uid uint32, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
+	defer s.Logout()
+	return s.AppendMessage(ctx, mbox, msg, flags, date)
+}
 
-	timestarted := time.Now()
-
-	var jobs []*imap.SeqSet
-
-	var jUids []uint32
-	for i := 0; i < len(uids); i++ {
-
-		if i%(jobSize) == 0 && i != 0 { //Append the new job to jobs
-			set, _ := imap.NewSeqSet("")
-			set.AddNum(jUids[:]...)
-			jobs = append(jobs, set)
-			jUids = nil
-		}
-		jUids = append(jUids, uids[i])
-		if i == len(uids)-1 { //Last Element Encountered Add to jobs
-			set, _ := imap.NewSeqSet("")
-			set.AddNum(jUids[:]...)
-			jobs = append(jobs, set)
-			jUids = nil
-		}
-	}
-
-	log.Printf("UnMarking: %d UIDs with %s total, %d jobs of size <= %d from %s\n", len(uids), imapFlag, len(jobs), jobSize, src)
-
-	for _, jobUIDs := range jobs {
-		log.Println("UnMarking ", jobUIDs)
-
-		err = WaitResp(c.UIDStore(jobUIDs, "-FLAGS.SILENT", imap.NewFlagSet(imapFlag)))
-		if err != nil {
-			log.Println(err)
-			continue
-		}
+//AppendMessageReader is like AppendMessage but reads the message of length size from r.
+//See Session.AppendMessageReader.
+func AppendMessageReader(acct *IMAPAccount, mbox string, r io.Reader, size int64, flags []string, date time.Time, skipCerti bool) (uid uint32, err error) {
+	return AppendMessageReaderContext(context.Background(), acct, mbox, r, size, flags, date, skipCerti)
+}
 
-	}
-	err = WaitResp(c.Close(false))
+//AppendMessageReaderContext is like AppendMessageReader but gives up when ctx is done.
+func AppendMessageReaderContext(ctx context.Context, acct *IMAPAccount, mbox string, r io.Reader, size int64, flags []string, date time.Time, skipCerti bool) (uid uint32, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
-		log.Println("Error While Closing ", err)
 		return
 	}
-	timeelapsed := time.Since(timestarted)
-	msecpermessage := timeelapsed.Seconds() / float64(len(uids)) * 1000
-	messagespersec := float64(len(uids)) / timeelapsed.Seconds()
-	log.Printf("Finished UnMarking %d messages in %.2fs (%.1fms per message; %.1f messages per second)\n", len(uids), timeelapsed.Seconds(), msecpermessage, messagespersec)
-
-	return
-
+	defer s.Logout()
+	return s.AppendMessageReader(ctx, mbox, r, size, flags, date)
 }
 
 //GetEmails gets Emails from mailbox mbox in Struct of Type MsgData.
@@ -598,90 +486,89 @@ func UnMarkEmails(acct *IMAPAccount, src string, imapFlag string, uids []uint32,
 //It is the caller's responsibility to quote strings when necessary.
 //All strings must use UTF-8 encoding.
 func GetEMails(acct *IMAPAccount, query string, mbox string, jobSize int, skipCerti bool) (mails []MsgData, err error) {
-	imap.DefaultLogger = log.New(os.Stdout, "", 0)
-	//	imap.DefaultLogMask = imap.LogConn | imap.LogRaw
-
-	log.Printf("Running for user '%s' on IMAP server '%s:%d'", acct.Username, acct.Server.Host, acct.Server.Port)
-
-	if jobSize <= 0 {
-		jobSize = 10
-	}
+	return GetEMailsContext(context.Background(), acct, query, mbox, jobSize, skipCerti)
+}
 
-	// Fetch UIDs.
-	c, errD := Dial(acct.Server, skipCerti)
-	if errD != nil {
-		err = errD
-		return
-	}
-	_, err = login(c, acct.Username, acct.Password)
+//GetEMailsContext is like GetEMails but gives up when ctx is done.
+func GetEMailsContext(ctx context.Context, acct *IMAPAccount, query string, mbox string, jobSize int, skipCerti bool) (mails []MsgData, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
-	defer c.Logout(-1)
-	if mbox == "" {
-		mbox = "inbox"
-	}
-	err = WaitResp(c.Select(mbox, true))
+	defer s.Logout()
+	return s.GetEMails(ctx, query, mbox, jobSize)
+}
+
+//StreamEMails is like GetEMails but calls fn for each Email as soon as it is fetched instead of returning all of them,
+//so mailboxes of any size can be processed in constant memory. Fetching stops if fn returns an error, which is then returned.
+func StreamEMails(acct *IMAPAccount, query string, mbox string, jobSize int, skipCerti bool, fn func(MsgData) error) (err error) {
+	return StreamEMailsContext(context.Background(), acct, query, mbox, jobSize, skipCerti, fn)
+}
+
+//StreamEMailsContext is like StreamEMails but gives up when ctx is done.
+func StreamEMailsContext(ctx context.Context, acct *IMAPAccount, query string, mbox string, jobSize int, skipCerti bool, fn func(MsgData) error) (err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
 	if err != nil {
 		return
 	}
-	uids, err1 := SearchUIDs(c, query)
-	if err1 != nil {
-		err = err1
-		return
-	}
-
-	timestarted := time.Now()
-
-	var jobs []*imap.SeqSet
+	defer s.Logout()
+	return s.StreamEMails(ctx, query, mbox, jobSize, fn)
+}
 
-	var jUids []uint32
-	for i := 0; i < len(uids); i++ {
-		/*Logic
-		1.If we are at last index len(uids)-1 and still have not reached jobSize limit then append that to jobs
-			(In other words if set size is smaller then jobsize)
-		2.if we go over index of size greater then jobsize then add all elemetns up to that index in to jobs
-		3.0 mod n returns 0 hence i!=0 is checked
+//SyncEMails passes the Emails of mailbox mbox which arrived since the last sync to fn,
+//keeping track of the last one in store. See Session.SyncEMails.
+func SyncEMails(acct *IMAPAccount, mbox string, store CheckpointStore, jobSize int, skipCerti bool, fn func(MsgData) error) (resync bool, err error) {
+	return SyncEMailsContext(context.Background(), acct, mbox, store, jobSize, skipCerti, fn)
+}
 
-		*/
-		if i%(jobSize) == 0 && i != 0 { //Append the new job to jobs
-			set, _ := imap.NewSeqSet("")
-			set.AddNum(jUids[:]...)
-			jobs = append(jobs, set)
-			jUids = nil
-		}
-		jUids = append(jUids, uids[i])
-		if i == len(uids)-1 { //Last Element Encountered Add to jobs
-			set, _ := imap.NewSeqSet("")
-			set.AddNum(jUids[:]...)
-			jobs = append(jobs, set)
-			jUids = nil
-		}
+//SyncEMailsContext is like SyncEMails but gives up when ctx is done.
+func SyncEMailsContext(ctx context.Context, acct *IMAPAccount, mbox string, store CheckpointStore, jobSize int, skipCerti bool, fn func(MsgData) error) (resync bool, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
+	if err != nil {
+		return
 	}
+	defer s.Logout()
+	return s.SyncEMails(ctx, mbox, store, jobSize, fn)
+}
 
-	log.Printf("%d UIDs total, %d jobs of size <= %d\n", len(uids), len(jobs), jobSize)
+//SyncChanges passes the flag changes and expunged mails of mailbox mbox since its checkpoint in store to fn.
+//See Session.SyncChanges.
+func SyncChanges(acct *IMAPAccount, mbox string, store CheckpointStore, skipCerti bool, fn func(*Changes) error) (resync bool, err error) {
+	return SyncChangesContext(context.Background(), acct, mbox, store, skipCerti, fn)
+}
 
-	for _, jobUIDs := range jobs {
-		fetched, errF := FetchMessages(c, jobUIDs)
-		if errF != nil {
-			log.Println("error while fetching ", jobUIDs, " ", err)
-			continue
-		}
-		for _, msg := range fetched {
-			mails = append(mails, msg)
-		}
+//SyncChangesContext is like SyncChanges but gives up when ctx is done.
+func SyncChangesContext(ctx context.Context, acct *IMAPAccount, mbox string, store CheckpointStore, skipCerti bool, fn func(*Changes) error) (resync bool, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
+	if err != nil {
+		return
 	}
+	defer s.Logout()
+	return s.SyncChanges(ctx, mbox, store, fn)
+}
 
-	timeelapsed := time.Since(timestarted)
-	msecpermessage := timeelapsed.Seconds() / float64(len(uids)) * 1000
-	messagespersec := float64(len(uids)) / timeelapsed.Seconds()
-	log.Printf("Finished fetching %d messages in %.2fs (%.1fms per message; %.1f messages per second)\n", len(uids), timeelapsed.Seconds(), msecpermessage, messagespersec)
+//ChangesSince returns the changes to the mails of mailbox mbox since the mod-sequence of checkpoint cp.
+//See Session.ChangesSince.
+func ChangesSince(acct *IMAPAccount, mbox string, cp Checkpoint, skipCerti bool) (ch *Changes, err error) {
+	return ChangesSinceContext(context.Background(), acct, mbox, cp, skipCerti)
+}
 
-	err = WaitResp(c.Close(false))
-	return
+//ChangesSinceContext is like ChangesSince but gives up when ctx is done.
+func ChangesSinceContext(ctx context.Context, acct *IMAPAccount, mbox string, cp Checkpoint, skipCerti bool) (ch *Changes, err error) {
+	s, err := NewSession(ctx, acct, skipCerti)
+	if err != nil {
+		return
+	}
+	defer s.Logout()
+	return s.ChangesSince(ctx, mbox, cp)
 }
 
 func SearchUIDs(c *imap.Client, query string) (uids []uint32, err error) {
+	return SearchUIDsContext(context.Background(), c, query)
+}
+
+//SearchUIDsContext is like SearchUIDs but gives up when ctx is done.
+func SearchUIDsContext(ctx context.Context, c *imap.Client, query string) (uids []uint32, err error) {
 	//cmd, err := c.UIDSearch("X-GM-RAW", fmt.Sprint("\"", query, "\""))
 	//cmd, err := c.UIDSearch(fmt.Sprint("\"", query, "\""))
 	cmd, err := c.UIDSearch(query)
@@ -689,80 +576,117 @@ func SearchUIDs(c *imap.Client, query string) (uids []uint32, err error) {
 		return
 	}
 	for cmd.InProgress() {
-		c.Recv(-1)
+		if err = recv(ctx, c); err != nil {
+			return
+		}
 		for _, rsp := range cmd.Data {
-			uids = rsp.SearchResults()
+			uids = append(uids, rsp.SearchResults()...)
 		}
 		cmd.Data = nil
 	}
+	if _, err = cmd.Result(imap.OK); err != nil {
+		uids = nil
+	}
 	return
 }
 
 func FetchAllUIDs(c *imap.Client) (uids []uint32, err error) {
-	maxmessages := 150000
-	uids = make([]uint32, maxmessages)
+	return FetchAllUIDsContext(context.Background(), c)
+}
 
-	set, errS := imap.NewSeqSet("1:*")
-	if errS != nil {
-		err = errS
+//FetchAllUIDsContext is like FetchAllUIDs but gives up when ctx is done.
+func FetchAllUIDsContext(ctx context.Context, c *imap.Client) (uids []uint32, err error) {
+	set, err := imap.NewSeqSet("1:*")
+	if err != nil {
 		return
 	}
 
-	cmd, errF := c.UIDFetch(set, "RFC822.SIZE")
-	if errF != nil {
-		err = errF
+	cmd, err := c.UIDFetch(set, "RFC822.SIZE")
+	if err != nil {
 		return
 	}
 
-	messagenum := uint32(0)
 	for cmd.InProgress() {
-		errC := c.Recv(-1)
-		if errC != nil {
-			continue
+		if err = recv(ctx, c); err != nil {
+			return nil, err
 		}
 		for _, rsp := range cmd.Data {
-			uid := imap.AsNumber(rsp.MessageInfo().Attrs["UID"])
-			uids[messagenum] = uid
+			if info := rsp.MessageInfo(); info != nil && info.UID != 0 {
+				uids = append(uids, info.UID)
+			}
 		}
 		cmd.Data = nil
-		messagenum++
 	}
-
-	uids = uids[:messagenum]
+	if _, err = cmd.Result(imap.OK); err != nil {
+		uids = nil
+	}
 	return
 }
 
 func FetchMessages(c *imap.Client, uidSet *imap.SeqSet) (fetched []MsgData, err error) {
+	return FetchMessagesContext(context.Background(), c, uidSet)
+}
+
+//FetchMessagesContext is like FetchMessages but gives up when ctx is done.
+func FetchMessagesContext(ctx context.Context, c *imap.Client, uidSet *imap.SeqSet) (fetched []MsgData, err error) {
+	err = FetchMessagesFunc(ctx, c, uidSet, func(msg MsgData) error {
+		fetched = append(fetched, msg)
+		return nil
+	})
+	return
+}
+
+//FetchMessagesFunc fetches the messages in uidSet and calls fn for each one as soon as it is received,
+//so that only one message at a time is held in memory. No more data is read from the server while fn runs.
+//Messages which can not be parsed are skipped.
+//If fn returns an error, the rest of the command is received but not parsed and that error is returned.
+func FetchMessagesFunc(ctx context.Context, c *imap.Client, uidSet *imap.SeqSet, fn func(MsgData) error) (err error) {
 	cmd, errF := c.UIDFetch(uidSet, "RFC822")
 	if errF != nil {
 		err = errF
 		return
 	}
 
+	var errFn error
+	deliver := deliverFetched(fn, nil, &errFn)
 	for cmd.InProgress() {
-		errC := c.Recv(-1)
+		errC := recv(ctx, c)
 		if errC != nil {
+			err = errC
 			return
 		}
 		for _, rsp := range cmd.Data {
-
-			uid := imap.AsNumber(rsp.MessageInfo().Attrs["UID"])
-			mime := imap.AsBytes(rsp.MessageInfo().Attrs["RFC822"])
-			msg, errR := mail.ReadMessage(bytes.NewReader(mime))
-			if errR != nil {
-				continue
-			}
-			if msg != nil {
-				msgdata := GetMessage(msg, uid)
-				fetched = append(fetched, msgdata)
-			}
+			deliver(rsp)
 		}
 		cmd.Data = nil
 	}
 
+	err = errFn
 	return
 }
 
+//deliverFetched returns the handler of the responses of UID FETCH RFC822. It passes the messages to fn
+//and the UIDs of those which can not be parsed to bad, if not nil, until fn fails with the error stored in *errFn.
+func deliverFetched(fn func(MsgData) error, bad func(uid uint32, err error), errFn *error) func(rsp *imap.Response) {
+	return func(rsp *imap.Response) {
+		if *errFn != nil || rsp.Label != "FETCH" {
+			return
+		}
+		info := rsp.MessageInfo()
+		if info == nil || info.UID == 0 {
+			return
+		}
+		msg, errR := mail.ReadMessage(bytes.NewReader(imap.AsBytes(info.Attrs["RFC822"])))
+		if errR != nil {
+			if bad != nil {
+				bad(info.UID, fmt.Errorf("%w: %v", ErrMalformed, errR))
+			}
+			return
+		}
+		*errFn = fn(GetMessage(msg, info.UID))
+	}
+}
+
 func GetMessage(msg *mail.Message, uid uint32) (msgData MsgData) {
 
 	msgData.Header = msg.Header
@@ -816,7 +740,6 @@ func GetMessageAsJSON(msg MsgData) (msgJSON string, err error) {
 
 	o, err3 := json.Marshal(msgdata)
 	if err3 != nil {
-		log.Println("error marshaling message as JSON: ", err3.Error()[:100])
 		err = err3
 		return
 	} else {
@@ -826,29 +749,6 @@ func GetMessageAsJSON(msg MsgData) (msgJSON string, err error) {
 	return
 }
 
-//Dial dials a connection to the IMAP server
-//If skipCerti is true then it will not check for the validity of the Certificate of the IMAP server,
-//good only if IMAP server is using self signed certi.
-func Dial(server *IMAPServer, skipCerti bool) (c *imap.Client, err error) {
-
-	addr := fmt.Sprintf("%s:%d", server.Host, server.Port)
-	if skipCerti {
-		config := &tls.Config{
-			InsecureSkipVerify: true,
-			ServerName:         server.Host,
-		}
-		c, err = imap.DialTLS(addr, config)
-	} else {
-		c, err = imap.DialTLS(addr, nil)
-	}
-	return
-}
-
-func login(c *imap.Client, user, pass string) (cmd *imap.Command, err error) {
-	defer c.SetLogMask(sensitive(c, "LOGIN"))
-	return c.Login(user, pass)
-}
-
 func sensitive(c *imap.Client, action string) imap.LogMask {
 	mask := c.SetLogMask(imap.LogConn)
 	hide := imap.LogCmd | imap.LogRaw
@@ -0,0 +1,215 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//makeJobs splits uids into jobs of at most jobSize UIDs.
+//A jobSize <= 0 means the default of 10.
+func makeJobs(uids []uint32, jobSize int) (jobs [][]uint32) {
+	if jobSize <= 0 {
+		jobSize = 10
+	}
+
+	var jUids []uint32
+	for i := 0; i < len(uids); i++ {
+		/*Logic
+		1.If we are at last index len(uids)-1 and still have not reached jobSize limit then append that to jobs
+			(In other words if set size is smaller then jobsize)
+		2.if we go over index of size greater then jobsize then add all elemetns up to that index in to jobs
+		3.0 mod n returns 0 hence i!=0 is checked
+
+		*/
+		if i%(jobSize) == 0 && i != 0 { //Append the new job to jobs
+			jobs = append(jobs, jUids)
+			jUids = nil
+		}
+		jUids = append(jUids, uids[i])
+		if i == len(uids)-1 { //Last Element Encountered Add to jobs
+			jobs = append(jobs, jUids)
+			jUids = nil
+		}
+	}
+	return
+}
+
+//uidSet returns the sequence set of uids.
+func uidSet(uids []uint32) *imap.SeqSet {
+	set, _ := imap.NewSeqSet("")
+	set.AddNum(uids...)
+	return set
+}
+
+//runJobs runs job i of jobs by calling run(w, i) with a worker session w which has mbox selected.
+//done(i, err) is then called with the result of run, always from the goroutine of the caller.
+//
+//With Options.Workers > 1 jobs are spread over that many connections, opening additional sessions
+//for the account as needed, and done is called in job order unless Options.Unordered is set.
+//Otherwise all jobs run in order on s itself.
+//A job failing with a transient error is run again according to Options.Retry.
+//run must therefore not repeat the parts of a job which already succeeded.
+//An EventBatch for op is sent after each job.
+//
+//If done returns an error no more jobs are started and runJobs returns that error once
+//the running jobs are finished.
+func (s *Session) runJobs(ctx context.Context, op string, mbox string, readOnly bool, jobs [][]uint32, run func(w *Session, i int) error, done func(i int, err error) error) (err error) {
+	workers := s.startWorkers(ctx, mbox, readOnly, len(jobs))
+	if len(workers) > 1 {
+		defer func() {
+			if ctx.Err() != nil { //Workers may have been interrupted in the middle of a command
+				s.closeWorkers(true)
+			}
+		}()
+	}
+	unordered := s.acct.Options != nil && s.acct.Options.Unordered
+	return schedule(ctx, len(workers), len(jobs), unordered, func(k int, i int) error {
+		start := time.Now()
+		w := workers[k]
+		err := w.retry(ctx, func() error { return run(w, i) })
+		s.obs.since(start, Event{Kind: EventBatch, Op: op, Mailbox: mbox, UIDs: len(jobs[i]), Err: err})
+		return err
+	}, done)
+}
+
+//schedule runs n jobs on the given number of workers, run(k, i) runs job i on worker k.
+//A single worker runs the jobs in the goroutine of the caller.
+func schedule(ctx context.Context, workers int, n int, unordered bool, run func(k int, i int) error, done func(i int, err error) error) (err error) {
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			if err = ctx.Err(); err != nil {
+				return
+			}
+			if err = done(i, run(0, i)); err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	type result struct {
+		i   int
+		err error
+	}
+	jobs := make(chan int)
+	results := make(chan result)
+	//window bounds the number of jobs started but not yet passed to done,
+	//so that results waiting for an earlier job are not piling up.
+	window := make(chan struct{}, 2*workers)
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for k := 0; k < workers; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			for i := range jobs {
+				results <- result{i, run(k, i)}
+			}
+		}(k)
+	}
+	go func() {
+		defer close(jobs)
+		for i := 0; i < n; i++ {
+			select {
+			case window <- struct{}{}:
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	pending := make(map[int]error)
+	next := 0
+	for r := range results {
+		if err != nil { //Stopped, only wait for the running jobs
+			continue
+		}
+		if unordered {
+			err = done(r.i, r.err)
+			<-window
+		} else {
+			pending[r.i] = r.err
+			for err == nil {
+				errJ, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				err = done(next, errJ)
+				<-window
+				next++
+			}
+		}
+		if err != nil {
+			close(stop)
+		}
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return
+}
+
+//startWorkers returns the sessions to run n jobs on, s first, each with mbox selected.
+//Missing worker sessions are dialed, a worker which cannot be set up is dropped and logged.
+func (s *Session) startWorkers(ctx context.Context, mbox string, readOnly bool, n int) (workers []*Session) {
+	want := 1
+	if s.acct.Options != nil && s.acct.Options.Workers > 1 {
+		want = s.acct.Options.Workers
+	}
+	if want > n {
+		want = n
+	}
+	for len(s.pool) < want-1 {
+		w, err := NewSession(ctx, s.acct, s.skipCerti)
+		if err != nil {
+			s.log.Warn("Could not start worker", "error", err)
+			break
+		}
+		s.pool = append(s.pool, w)
+	}
+
+	workers = append(workers, s)
+	for _, w := range s.pool {
+		if len(workers) == want {
+			break
+		}
+		if err := w.begin(ctx); err != nil {
+			continue
+		}
+		if err := w.selectMbox(mbox, readOnly); err != nil {
+			s.log.Warn("Could not select mailbox on worker", "mailbox", mbox, "error", err)
+			continue
+		}
+		workers = append(workers, w)
+	}
+	return
+}
+
+//closeWorkers logs out the worker sessions, aborting them if abort is true.
+func (s *Session) closeWorkers(abort bool) {
+	for _, w := range s.pool {
+		if abort {
+			w.abort()
+		} else {
+			w.Logout()
+		}
+	}
+	s.pool = nil
+}
@@ -0,0 +1,96 @@
+package Simap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_makeJobs(t *testing.T) {
+	uids := []uint32{1, 2, 3, 4, 5, 6, 7}
+	jobs := makeJobs(uids, 3)
+	if len(jobs) != 3 {
+		t.Fatalf("7 UIDs in jobs of 3 should make 3 jobs, got %d", len(jobs))
+	}
+	if len(makeJobs(uids, 0)) != 1 {
+		t.Errorf("default job size should put 7 UIDs in 1 job")
+	}
+	if len(makeJobs(nil, 3)) != 0 {
+		t.Errorf("no UIDs should make no jobs")
+	}
+}
+
+func Test_scheduleOrdered(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		var mu sync.Mutex
+		used := make(map[int]bool)
+		var order []int
+		err := schedule(context.Background(), workers, 20, false, func(k int, i int) error {
+			mu.Lock()
+			used[k] = true
+			mu.Unlock()
+			time.Sleep(time.Duration(20-i) * time.Millisecond) //Later jobs finish first
+			return nil
+		}, func(i int, err error) error {
+			order = append(order, i)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%d workers: %s", workers, err)
+		}
+		for i, j := range order {
+			if i != j {
+				t.Fatalf("%d workers: jobs should be done in order, got %v", workers, order)
+			}
+		}
+		if len(order) != 20 || len(used) != workers {
+			t.Errorf("%d workers: %d jobs done by %d workers", workers, len(order), len(used))
+		}
+	}
+}
+
+func Test_scheduleUnordered(t *testing.T) {
+	seen := make(map[int]bool)
+	err := schedule(context.Background(), 3, 10, true, func(k int, i int) error {
+		time.Sleep(time.Duration(10-i) * time.Millisecond)
+		return nil
+	}, func(i int, err error) error {
+		seen[i] = true
+		return nil
+	})
+	if err != nil || len(seen) != 10 {
+		t.Errorf("all 10 jobs should be done once, got %d, %v", len(seen), err)
+	}
+}
+
+func Test_scheduleStop(t *testing.T) {
+	stop := errors.New("stop")
+	var mu sync.Mutex
+	started := 0
+	err := schedule(context.Background(), 2, 100, false, func(k int, i int) error {
+		mu.Lock()
+		started++
+		mu.Unlock()
+		return nil
+	}, func(i int, err error) error {
+		if i == 5 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("error of done should be returned, got %v", err)
+	}
+	if started == 100 {
+		t.Errorf("no more jobs should start after done fails")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = schedule(ctx, 2, 10, false, func(k int, i int) error { return ctx.Err() }, func(i int, err error) error { return nil })
+	if err != context.Canceled {
+		t.Errorf("cancelled context should give context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+//Logger receives the log output of the package. *slog.Logger satisfies it.
+//args are alternating keys and values, e.g. "mailbox", "INBOX", "uids", 10.
+//Passwords and tokens are never passed to a Logger.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+//nopLogger discards everything, it is used when Options.Logger is nil.
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...any) {}
+func (nopLogger) Info(msg string, args ...any)  {}
+func (nopLogger) Warn(msg string, args ...any)  {}
+func (nopLogger) Error(msg string, args ...any) {}
+
+//fieldLogger adds fields to every record of l.
+type fieldLogger struct {
+	l      Logger
+	fields []any
+}
+
+func (f fieldLogger) with(args []any) []any {
+	return append(append(make([]any, 0, len(f.fields)+len(args)), f.fields...), args...)
+}
+
+func (f fieldLogger) Debug(msg string, args ...any) { f.l.Debug(msg, f.with(args)...) }
+func (f fieldLogger) Info(msg string, args ...any)  { f.l.Info(msg, f.with(args)...) }
+func (f fieldLogger) Warn(msg string, args ...any)  { f.l.Warn(msg, f.with(args)...) }
+func (f fieldLogger) Error(msg string, args ...any) { f.l.Error(msg, f.with(args)...) }
+
+//logger returns the Logger of acct with the account and server as fields.
+func (acct *IMAPAccount) logger() Logger {
+	if acct.Options == nil || acct.Options.Logger == nil {
+		return nopLogger{}
+	}
+	return fieldLogger{acct.Options.Logger, []any{
+		"account", acct.Username,
+		"server", fmt.Sprintf("%s:%d", acct.Server.Host, acct.Server.Port),
+	}}
+}
+
+//imapWriter passes the protocol log of the imap client, enabled by imap.DefaultLogMask
+//or Client().SetLogMask, to l at debug level.
+//Commands carrying credentials are hidden from it by sensitive.
+type imapWriter struct {
+	l Logger
+}
+
+func (w imapWriter) Write(p []byte) (int, error) {
+	w.l.Debug(strings.TrimRight(string(p), "\r\n"), "source", "imap")
+	return len(p), nil
+}
+
+//setLogger routes the protocol log of c to l.
+func setLogger(c *imap.Client, l Logger) {
+	c.SetLogger(log.New(imapWriter{l}, "", 0))
+}
@@ -0,0 +1,41 @@
+package Simap
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type recordLogger struct {
+	lines []string
+}
+
+func (r *recordLogger) record(level string, msg string, args []any) {
+	r.lines = append(r.lines, fmt.Sprint(level, " ", msg, " ", args))
+}
+
+func (r *recordLogger) Debug(msg string, args ...any) { r.record("DEBUG", msg, args) }
+func (r *recordLogger) Info(msg string, args ...any)  { r.record("INFO", msg, args) }
+func (r *recordLogger) Warn(msg string, args ...any)  { r.record("WARN", msg, args) }
+func (r *recordLogger) Error(msg string, args ...any) { r.record("ERROR", msg, args) }
+
+func Test_accountLogger(t *testing.T) {
+	if _, ok := (&IMAPAccount{}).logger().(nopLogger); !ok {
+		t.Errorf("an account without Logger should log nothing")
+	}
+	rec := new(recordLogger)
+	acct := &IMAPAccount{Username: "user", Password: "secret", Server: &IMAPServer{Host: "imap.example.com", Port: 993},
+		Options: &Options{Logger: rec}}
+	l := acct.logger()
+	l.Info("Copying", "uids", 3)
+	l.Debug("Copying job", "uids", 2)
+	want := "INFO Copying [account user server imap.example.com:993 uids 3]"
+	if len(rec.lines) != 2 || rec.lines[0] != want {
+		t.Fatalf("got %q, want first line %q", rec.lines, want)
+	}
+	for _, line := range rec.lines {
+		if strings.Contains(line, "secret") {
+			t.Errorf("password logged: %q", line)
+		}
+	}
+}
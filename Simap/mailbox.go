@@ -0,0 +1,284 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//MboxInfo describes a mailbox/folder on the server.
+type MboxInfo struct {
+	Name       string
+	Delim      string   //Hierarchy delimiter such as "/" or ".", "" if the server has a flat namespace
+	Attrs      []string //Attributes such as `\Noselect` or `\HasChildren`, sorted
+	Subscribed bool
+}
+
+//HasAttr reports whether the mailbox has attribute attr, ignoring case.
+func (m MboxInfo) HasAttr(attr string) bool {
+	for _, a := range m.Attrs {
+		if strings.EqualFold(a, attr) {
+			return true
+		}
+	}
+	return false
+}
+
+//ListMailboxes lists the mailboxes matching pattern relative to reference ref with LIST
+//and tells which are subscribed with LSUB. See RFC 3501 section 6.3.8.
+//In pattern "*" matches any part of a name and "%" any part of a name up to the hierarchy delimiter,
+//so ListMailboxes(ctx, "", "*") lists all mailboxes.
+func (s *Session) ListMailboxes(ctx context.Context, ref string, pattern string) (mboxes []MboxInfo, err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	err = s.retry(ctx, func() (err error) {
+		mboxes, err = s.list(ref, pattern)
+		if err != nil {
+			return
+		}
+		subscribed, err := s.lsub(ref, pattern)
+		if err != nil {
+			return
+		}
+		for i := range mboxes {
+			mboxes[i].Subscribed = subscribed[mboxes[i].Name]
+		}
+		return
+	})
+	return
+}
+
+//list sends LIST and returns the mailboxes in the order the server sent them.
+func (s *Session) list(ref string, pattern string) (mboxes []MboxInfo, err error) {
+	_, data, err := s.result(s.c.List(ref, pattern))
+	if err != nil {
+		return
+	}
+	for _, rsp := range data {
+		if rsp.Label == "LIST" {
+			mboxes = append(mboxes, mboxInfo(rsp.MailboxInfo()))
+		}
+	}
+	return
+}
+
+//lsub returns the names of the subscribed mailboxes matching pattern.
+func (s *Session) lsub(ref string, pattern string) (names map[string]bool, err error) {
+	_, data, err := s.result(s.c.LSub(ref, pattern))
+	if err != nil {
+		return
+	}
+	names = make(map[string]bool)
+	for _, rsp := range data {
+		if rsp.Label == "LSUB" {
+			names[rsp.MailboxInfo().Name] = true
+		}
+	}
+	return
+}
+
+func mboxInfo(info *imap.MailboxInfo) (m MboxInfo) {
+	m.Name = info.Name
+	m.Delim = info.Delim
+	for attr := range info.Attrs {
+		m.Attrs = append(m.Attrs, attr)
+	}
+	sort.Strings(m.Attrs)
+	return
+}
+
+//mboxExists reports whether mailbox name exists and can be selected.
+func (s *Session) mboxExists(name string) (exists bool, err error) {
+	m, err := s.lookupMbox(name)
+	exists = m != nil && !m.HasAttr(`\Noselect`)
+	return
+}
+
+//lookupMbox returns the LIST entry of mailbox name, nil if there is none.
+//A \Noselect entry is returned for a name which only exists as the parent of other mailboxes.
+func (s *Session) lookupMbox(name string) (m *MboxInfo, err error) {
+	mboxes, err := s.list("", name)
+	if err != nil {
+		return
+	}
+	return findMbox(mboxes, name), nil
+}
+
+//findMbox returns the entry of mailbox name among mboxes, nil if there is none.
+//Names are compared in UTF-8 as the imap package decodes the modified UTF-7 names of LIST.
+func findMbox(mboxes []MboxInfo, name string) *MboxInfo {
+	for i := range mboxes {
+		//INBOX is case-insensitive, RFC 3501 section 5.1
+		if (mboxes[i].Name == name || strings.EqualFold(name, "INBOX") && strings.EqualFold(mboxes[i].Name, name)) && !mboxes[i].HasAttr(`\NonExistent`) {
+			return &mboxes[i]
+		}
+	}
+	return nil
+}
+
+//delimiter returns the hierarchy delimiter of the server, "" if it has a flat namespace.
+func (s *Session) delimiter() (delim string, err error) {
+	if s.delim != nil {
+		return *s.delim, nil
+	}
+	mboxes, err := s.list("", "") //Special case returning just the delimiter, RFC 3501 section 6.3.8
+	if err != nil {
+		return
+	}
+	if len(mboxes) > 0 {
+		delim = mboxes[0].Delim
+	}
+	s.delim = &delim
+	return
+}
+
+//parents returns the names of the superiors of mailbox name, outermost first, e.g. "a" and "a/b" for "a/b/c".
+func parents(name string, delim string) (names []string) {
+	if delim == "" {
+		return
+	}
+	for i := strings.Index(name, delim); i >= 0; {
+		if i > 0 {
+			names = append(names, name[:i])
+		}
+		next := strings.Index(name[i+len(delim):], delim)
+		if next < 0 {
+			break
+		}
+		i += len(delim) + next
+	}
+	return
+}
+
+//createParents creates the missing superiors of mailbox name, for servers which do not create them on their own.
+//They are subscribed if subscribe is true.
+func (s *Session) createParents(name string, subscribe bool) (err error) {
+	delim, err := s.delimiter()
+	if err != nil {
+		return
+	}
+	for _, parent := range parents(name, delim) {
+		m, err := s.lookupMbox(parent)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			continue
+		}
+		if err = s.create(parent, subscribe); err != nil {
+			return err
+		}
+	}
+	return
+}
+
+//RenameMbox renames mailbox oldName to newName, along with the mailboxes below it.
+//Missing superiors of newName are created.
+func (s *Session) RenameMbox(ctx context.Context, oldName string, newName string) (err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	if oldName == "" || newName == "" {
+		err = errors.New("No mailbox name provided")
+		return
+	}
+	delim, err := s.delimiter()
+	if err != nil {
+		return
+	}
+	if s.mbox == oldName || delim != "" && strings.HasPrefix(s.mbox, oldName+delim) {
+		if err = s.closeMbox(); err != nil {
+			return
+		}
+	}
+	if err = s.createParents(newName, false); err != nil {
+		return
+	}
+	s.special = nil
+	return s.wait(s.c.Rename(oldName, newName))
+}
+
+//DeleteMboxTree deletes mailbox name along with all the mailboxes below it.
+//If moveTo is not "" the messages of all these mailboxes are first moved to mailbox moveTo,
+//a mailbox whose messages could not all be moved is not deleted.
+//If name does not exist then do nothing.
+func (s *Session) DeleteMboxTree(ctx context.Context, name string, moveTo string) (err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	if name == "" {
+		err = errors.New("No mailbox name provided")
+		return
+	}
+	delim, err := s.delimiter()
+	if err != nil {
+		return
+	}
+	inTree := func(mbox string) bool {
+		return mbox == name || delim != "" && strings.HasPrefix(mbox, name+delim)
+	}
+	if moveTo != "" && inTree(moveTo) {
+		err = fmt.Errorf("Cannot move the messages of %q into %q which is deleted with it", name, moveTo)
+		return
+	}
+
+	var tree []MboxInfo
+	if delim != "" {
+		if tree, err = s.list("", name+delim+"*"); err != nil {
+			return
+		}
+	}
+	m, err := s.lookupMbox(name)
+	if err != nil {
+		return
+	}
+	if m != nil {
+		tree = append(tree, *m)
+	}
+	//Deepest first so that every mailbox is empty of children when it is deleted
+	sort.SliceStable(tree, func(i, j int) bool {
+		return strings.Count(tree[i].Name, delim) > strings.Count(tree[j].Name, delim)
+	})
+
+	s.special = nil
+	for _, m := range tree {
+		if !inTree(m.Name) || m.HasAttr(`\NonExistent`) {
+			continue
+		}
+		if moveTo != "" && !m.HasAttr(`\Noselect`) {
+			if err = s.moveAll(ctx, m.Name, moveTo); err != nil {
+				return
+			}
+		}
+		if s.mbox == m.Name {
+			if err = s.closeMbox(); err != nil {
+				return
+			}
+		}
+		s.log.Info("Deleting mailbox", "mailbox", m.Name)
+		if err = s.wait(s.c.Delete(m.Name)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+//moveAll moves all messages of mailbox src to dst.
+func (s *Session) moveAll(ctx context.Context, src string, dst string) (err error) {
+	if err = s.selectMbox(src, false); err != nil {
+		return
+	}
+	uids, err := s.searchUIDs("ALL")
+	if err != nil || len(uids) == 0 {
+		return
+	}
+	_, err = s.MoveEmails(ctx, src, dst, uids, 0)
+	return
+}
@@ -0,0 +1,66 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_mboxInfo(t *testing.T) {
+	m := mboxInfo(&imap.MailboxInfo{Name: "Archive/2024", Delim: "/", Attrs: imap.FlagSet{`\HasNoChildren`: true, `\Archive`: true}})
+	if m.Name != "Archive/2024" || m.Delim != "/" {
+		t.Errorf("mboxInfo = %+v", m)
+	}
+	if !reflect.DeepEqual(m.Attrs, []string{`\Archive`, `\HasNoChildren`}) {
+		t.Errorf("Attrs = %v, want them sorted", m.Attrs)
+	}
+	if !m.HasAttr(`\hasnochildren`) || m.HasAttr(`\Noselect`) {
+		t.Errorf("HasAttr should match attributes ignoring case only")
+	}
+}
+
+func Test_parents(t *testing.T) {
+	tests := []struct {
+		name  string
+		delim string
+		want  []string
+	}{
+		{"a/b/c", "/", []string{"a", "a/b"}},
+		{"INBOX.Archive.2024", ".", []string{"INBOX", "INBOX.Archive"}},
+		{"/a/b", "/", []string{"/a"}},
+		{"a", "/", nil},
+		{"a/b", "", nil},
+	}
+	for _, tt := range tests {
+		if got := parents(tt.name, tt.delim); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parents(%q, %q) = %q, want %q", tt.name, tt.delim, got, tt.want)
+		}
+	}
+}
+
+func Test_findMbox(t *testing.T) {
+	mboxes := []MboxInfo{
+		{Name: "Inbox", Delim: "/"},
+		{Name: "Entwürfe", Delim: "/"},
+		{Name: "Gone", Delim: "/", Attrs: []string{`\NonExistent`}},
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Entwürfe", "Entwürfe"},
+		{"Entw&APw-rfe", ""}, //Names are compared in UTF-8, not modified UTF-7
+		{"INBOX", "Inbox"},
+		{"entwürfe", ""},
+		{"Gone", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if m := findMbox(mboxes, tt.name); m != nil {
+			got = m.Name
+		}
+		if got != tt.want {
+			t.Errorf("findMbox(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package Simap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//Metrics is an Observer which collects counters of the events per account
+//and exposes them in the Prometheus text format.
+//Set it as Options.Observer of every account to monitor and serve it over HTTP or call WriteTo.
+type Metrics struct {
+	mu     sync.Mutex
+	values map[string]map[string]float64 //Series name -> labels -> value
+}
+
+//NewMetrics returns an empty Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{values: make(map[string]map[string]float64)}
+}
+
+type metricDesc struct {
+	name string
+	typ  string
+	help string
+}
+
+var metricDescs = []metricDesc{
+	{"simap_connects_total", "counter", "Connections to the IMAP server by result."},
+	{"simap_connect_duration_seconds", "summary", "Time taken to connect, including TLS."},
+	{"simap_logins_total", "counter", "Logins by result."},
+	{"simap_selects_total", "counter", "Mailbox selections by result."},
+	{"simap_commands_in_flight", "gauge", "Commands waiting for their response."},
+	{"simap_commands_total", "counter", "Completed commands by command and result."},
+	{"simap_command_duration_seconds", "summary", "Time taken by commands."},
+	{"simap_bytes_total", "counter", "Bytes read from and written to the IMAP server."},
+	{"simap_batches_total", "counter", "Jobs of bulk operations by operation and result."},
+	{"simap_batch_messages_total", "counter", "Messages in the jobs of bulk operations by operation and result."},
+	{"simap_batch_duration_seconds", "summary", "Time taken by the jobs of bulk operations."},
+	{"simap_retries_total", "counter", "Reconnects to retry after a transient failure."},
+}
+
+//Observe implements Observer.
+func (m *Metrics) Observe(ev Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := "ok"
+	if ev.Err != nil {
+		result = "error"
+	}
+	switch ev.Kind {
+	case EventConnect:
+		m.add("simap_connects_total", 1, "account", ev.Account, "result", result)
+		m.observe("simap_connect_duration_seconds", ev, "account", ev.Account)
+	case EventLogin:
+		m.add("simap_logins_total", 1, "account", ev.Account, "result", result)
+	case EventSelect:
+		m.add("simap_selects_total", 1, "account", ev.Account, "result", result)
+	case EventCommandStart:
+		m.add("simap_commands_in_flight", 1, "account", ev.Account)
+	case EventCommandFinish:
+		m.add("simap_commands_in_flight", -1, "account", ev.Account)
+		m.add("simap_commands_total", 1, "account", ev.Account, "command", ev.Command, "result", result)
+		m.observe("simap_command_duration_seconds", ev, "account", ev.Account, "command", ev.Command)
+	case EventRead:
+		m.add("simap_bytes_total", float64(ev.Bytes), "account", ev.Account, "direction", "read")
+	case EventWrite:
+		m.add("simap_bytes_total", float64(ev.Bytes), "account", ev.Account, "direction", "write")
+	case EventBatch:
+		m.add("simap_batches_total", 1, "account", ev.Account, "op", ev.Op, "result", result)
+		m.add("simap_batch_messages_total", float64(ev.UIDs), "account", ev.Account, "op", ev.Op, "result", result)
+		m.observe("simap_batch_duration_seconds", ev, "account", ev.Account, "op", ev.Op)
+	case EventRetry:
+		m.add("simap_retries_total", 1, "account", ev.Account)
+	}
+}
+
+//add adds v to the series name with labels given as name, value pairs.
+func (m *Metrics) add(name string, v float64, labels ...string) {
+	var b strings.Builder
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+	}
+	series := m.values[name]
+	if series == nil {
+		series = make(map[string]float64)
+		m.values[name] = series
+	}
+	series[b.String()] += v
+}
+
+//observe adds the duration of ev to the summary name.
+func (m *Metrics) observe(name string, ev Event, labels ...string) {
+	m.add(name+"_sum", ev.Duration.Seconds(), labels...)
+	m.add(name+"_count", 1, labels...)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+//WriteTo writes all metrics to w in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (n int64, err error) {
+	var buf bytes.Buffer
+	m.mu.Lock()
+	for _, d := range metricDescs {
+		names := []string{d.name}
+		if d.typ == "summary" {
+			names = []string{d.name + "_sum", d.name + "_count"}
+		}
+		if m.values[names[0]] == nil {
+			continue
+		}
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, d.typ)
+		for _, name := range names {
+			series := m.values[name]
+			labels := make([]string, 0, len(series))
+			for l := range series {
+				labels = append(labels, l)
+			}
+			sort.Strings(labels)
+			for _, l := range labels {
+				fmt.Fprintf(&buf, "%s{%s} %g\n", name, l, series[l])
+			}
+		}
+	}
+	m.mu.Unlock()
+	return buf.WriteTo(w)
+}
+
+//ServeHTTP serves the metrics for scraping by Prometheus.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
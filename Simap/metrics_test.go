@@ -0,0 +1,43 @@
+package Simap
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Metrics(t *testing.T) {
+	m := NewMetrics()
+	m.Observe(Event{Kind: EventLogin, Account: "user"})
+	m.Observe(Event{Kind: EventCommandStart, Account: "user", Command: "UID COPY"})
+	m.Observe(Event{Kind: EventCommandFinish, Account: "user", Command: "UID COPY", Duration: time.Second})
+	m.Observe(Event{Kind: EventRead, Account: "user", Bytes: 100})
+	m.Observe(Event{Kind: EventRead, Account: "user", Bytes: 20})
+	m.Observe(Event{Kind: EventBatch, Account: "user", Op: "Copying", UIDs: 10, Err: errors.New("NO")})
+	m.Observe(Event{Kind: EventBatch, Account: `a"b`, Op: "Copying", UIDs: 5})
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE simap_logins_total counter\n",
+		`simap_logins_total{account="user",result="ok"} 1`,
+		`simap_commands_in_flight{account="user"} 0`,
+		`simap_command_duration_seconds_sum{account="user",command="UID COPY"} 1`,
+		`simap_command_duration_seconds_count{account="user",command="UID COPY"} 1`,
+		`simap_bytes_total{account="user",direction="read"} 120`,
+		`simap_batch_messages_total{account="user",op="Copying",result="error"} 10`,
+		`simap_batches_total{account="a\"b",op="Copying",result="ok"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "simap_selects_total") {
+		t.Errorf("metrics without events should not be written:\n%s", out)
+	}
+}
@@ -0,0 +1,52 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+
+//MoveStrategy is the way MoveEmails moves messages, depending on the extensions of the server.
+type MoveStrategy int
+
+const (
+	//MoveUIDMove moves atomically with UID MOVE, RFC 6851.
+	MoveUIDMove MoveStrategy = iota + 1
+	//MoveCopyUIDExpunge copies, flags the messages \Deleted and removes only them with UID EXPUNGE, RFC 4315.
+	MoveCopyUIDExpunge
+	//MoveCopyExpunge copies, flags the messages \Deleted and EXPUNGEs the mailbox.
+	//This also removes any other message flagged \Deleted in the mailbox.
+	MoveCopyExpunge
+)
+
+func (m MoveStrategy) String() string {
+	switch m {
+	case MoveUIDMove:
+		return "UID MOVE"
+	case MoveCopyUIDExpunge:
+		return "UID COPY+UID EXPUNGE"
+	case MoveCopyExpunge:
+		return "UID COPY+EXPUNGE"
+	}
+	return "none"
+}
+
+//chooseMoveStrategy returns the best MoveStrategy supported by a server with capabilities caps.
+func chooseMoveStrategy(caps map[string]bool) MoveStrategy {
+	switch {
+	case caps["MOVE"]:
+		return MoveUIDMove
+	case caps["UIDPLUS"]:
+		return MoveCopyUIDExpunge
+	}
+	return MoveCopyExpunge
+}
+
+//uidMove moves the messages in uidSet to mailbox dst with UID MOVE.
+func (s *Session) uidMove(uidSet *imap.SeqSet, dst string) (cmd *imap.Command, err error) {
+	if s.c.CommandConfig["UID MOVE"] == nil { //Unknown to the imap package
+		//COPYUID comes in an untagged OK before the tagged response, RFC 6851 section 4.3,
+		//followed by an EXPUNGE, or VANISHED with QRESYNC, for each moved message.
+		s.c.CommandConfig["UID MOVE"] = &imap.CommandConfig{
+			States: s.c.CommandConfig["UID COPY"].States,
+			Filter: imap.LabelFilter("COPYUID", "EXPUNGE", "VANISHED"),
+		}
+	}
+	return s.c.Send("UID MOVE", uidSet, s.c.Quote(imap.UTF7Encode(dst)))
+}
@@ -0,0 +1,20 @@
+package Simap
+
+import "testing"
+
+func Test_chooseMoveStrategy(t *testing.T) {
+	tests := []struct {
+		caps map[string]bool
+		want MoveStrategy
+	}{
+		{map[string]bool{"MOVE": true, "UIDPLUS": true}, MoveUIDMove},
+		{map[string]bool{"MOVE": true}, MoveUIDMove},
+		{map[string]bool{"UIDPLUS": true}, MoveCopyUIDExpunge},
+		{map[string]bool{"IMAP4REV1": true}, MoveCopyExpunge},
+	}
+	for _, tt := range tests {
+		if got := chooseMoveStrategy(tt.caps); got != tt.want {
+			t.Errorf("chooseMoveStrategy(%v) = %v, want %v", tt.caps, got, tt.want)
+		}
+	}
+}
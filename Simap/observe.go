@@ -0,0 +1,130 @@
+package Simap
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+//EventKind tells what an Event is about.
+type EventKind int
+
+const (
+	//EventConnect is sent once the connection to the server is set up, including TLS.
+	EventConnect EventKind = iota
+	//EventLogin is sent once the server accepted or rejected the credentials.
+	EventLogin
+	//EventSelect is sent once a mailbox has been selected.
+	EventSelect
+	//EventCommandStart is sent when the session starts waiting for the response of a command.
+	EventCommandStart
+	//EventCommandFinish is sent when the command has completed.
+	EventCommandFinish
+	//EventRead is sent for data read from the connection.
+	EventRead
+	//EventWrite is sent for data written to the connection.
+	EventWrite
+	//EventBatch is sent when a job of a bulk operation has finished.
+	EventBatch
+	//EventRetry is sent before the session reconnects to retry after Err.
+	EventRetry
+)
+
+var eventKindNames = []string{"connect", "login", "select", "command_start", "command_finish", "read", "write", "batch", "retry"}
+
+func (k EventKind) String() string {
+	if k < 0 || int(k) >= len(eventKindNames) {
+		return fmt.Sprintf("EventKind(%d)", int(k))
+	}
+	return eventKindNames[k]
+}
+
+//Event describes something that happened on a connection of an account.
+//Only the fields which make sense for Kind are set.
+type Event struct {
+	Kind     EventKind
+	Account  string //Username of the account
+	Server   string //host:port of the server
+	Op       string //Operation of a batch, e.g. "Copying"
+	Mailbox  string
+	Command  string        //Name of the command, e.g. "UID COPY"
+	UIDs     int           //Number of messages in a batch
+	Bytes    int           //Number of bytes read or written
+	Duration time.Duration //How long a connect, login, select, command or batch took
+	Err      error         //Why it failed, nil on success
+}
+
+//Observer receives the events of the sessions of an account, set it in Options.Observer.
+//Observe is called from every connection of the account and must be safe for concurrent use.
+//It should return quickly as it is called while commands are running.
+type Observer interface {
+	Observe(ev Event)
+}
+
+//ObserverFunc adapts a function to an Observer.
+type ObserverFunc func(ev Event)
+
+func (f ObserverFunc) Observe(ev Event) {
+	f(ev)
+}
+
+//observer sends events of one account to the Observer of its Options, if any.
+type observer struct {
+	o       Observer
+	account string
+	server  string
+}
+
+func (acct *IMAPAccount) observer() (obs observer) {
+	if acct.Options == nil || acct.Options.Observer == nil {
+		return
+	}
+	return observer{acct.Options.Observer, acct.Username, fmt.Sprintf("%s:%d", acct.Server.Host, acct.Server.Port)}
+}
+
+func (obs observer) emit(ev Event) {
+	if obs.o == nil {
+		return
+	}
+	ev.Account = obs.account
+	ev.Server = obs.server
+	obs.o.Observe(ev)
+}
+
+//since emits ev with the time elapsed since start as its Duration.
+func (obs observer) since(start time.Time, ev Event) {
+	ev.Duration = time.Since(start)
+	obs.emit(ev)
+}
+
+//wrap returns conn counting the bytes read and written, or nil if there is no Observer.
+func (obs observer) wrap() func(conn net.Conn) net.Conn {
+	if obs.o == nil {
+		return nil
+	}
+	return func(conn net.Conn) net.Conn {
+		return &countingConn{conn, obs}
+	}
+}
+
+//countingConn sends EventRead and EventWrite for the data going through it.
+type countingConn struct {
+	net.Conn
+	obs observer
+}
+
+func (c *countingConn) Read(p []byte) (n int, err error) {
+	n, err = c.Conn.Read(p)
+	if n > 0 {
+		c.obs.emit(Event{Kind: EventRead, Bytes: n})
+	}
+	return
+}
+
+func (c *countingConn) Write(p []byte) (n int, err error) {
+	n, err = c.Conn.Write(p)
+	if n > 0 {
+		c.obs.emit(Event{Kind: EventWrite, Bytes: n})
+	}
+	return
+}
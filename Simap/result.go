@@ -0,0 +1,133 @@
+package Simap
+
+import (
+	"errors"
+	"fmt"
+)
+
+//UIDError is the error of a job, for all the UIDs of that job.
+type UIDError struct {
+	UIDs []uint32
+	Err  error
+}
+
+func (e UIDError) Error() string {
+	return fmt.Sprintf("UIDs %v: %s", e.UIDs, e.Err)
+}
+
+func (e UIDError) Unwrap() error {
+	return e.Err
+}
+
+//Result tells which UIDs an operation succeeded on and which failed and why,
+//so that exactly the failed ones can be retried.
+type Result struct {
+	Succeeded []uint32
+	Failed    []UIDError
+	//Strategy is how MoveEmails moved the messages, 0 for other operations.
+	Strategy MoveStrategy
+	//UIDMap maps the UIDs of copied or moved messages to the UIDs of the copies in the destination mailbox.
+	//It is only set if the server supports UIDPLUS, RFC 4315.
+	UIDMap map[uint32]uint32
+	//UIDValidity is the UIDVALIDITY of the destination mailbox the UIDs in UIDMap are valid for.
+	UIDValidity uint32
+}
+
+//FailedUIDs returns the UIDs of all failed jobs.
+func (r *Result) FailedUIDs() (uids []uint32) {
+	for _, f := range r.Failed {
+		uids = append(uids, f.UIDs...)
+	}
+	return
+}
+
+func (r *Result) add(uids []uint32, err error) {
+	if err == nil {
+		r.Succeeded = append(r.Succeeded, uids...)
+	} else {
+		r.Failed = append(r.Failed, UIDError{uids, err})
+	}
+}
+
+//addMapping adds the COPYUID of a job to UIDMap.
+func (r *Result) addMapping(m uidMapping) {
+	if len(m.src) == 0 {
+		return
+	}
+	if r.UIDMap == nil {
+		r.UIDMap = make(map[uint32]uint32)
+	}
+	r.UIDValidity = m.validity
+	for i, uid := range m.src {
+		r.UIDMap[uid] = m.dst[i]
+	}
+}
+
+//splitModified adds the UIDs of a conditional STORE job, the modified ones as failed with ErrModified.
+func (r *Result) splitModified(uids []uint32, modified []uint32) {
+	if stored := subtractUIDs(uids, modified); len(stored) > 0 {
+		r.add(stored, nil)
+	}
+	r.add(modified, ErrModified)
+}
+
+//err returns a *BatchError for op if any job failed.
+func (r *Result) err(op string) error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+	return &BatchError{Op: op, Succeeded: len(r.Succeeded), Failed: r.Failed}
+}
+
+//BatchError is returned when some of the jobs of an operation failed while others succeeded.
+//errors.Is and errors.As look through the errors of all failed jobs.
+type BatchError struct {
+	Op        string //e.g. "Copying"
+	Succeeded int    //Number of UIDs which succeeded
+	Failed    []UIDError
+}
+
+func (e *BatchError) Error() string {
+	failed := 0
+	for _, f := range e.Failed {
+		failed += len(f.UIDs)
+	}
+	return fmt.Sprintf("%s: %d of %d messages failed, first error: %s", e.Op, failed, failed+e.Succeeded, e.Failed[0].Err)
+}
+
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, f := range e.Failed {
+		errs[i] = f
+	}
+	return errs
+}
+
+//ErrNotFetched is the error of a message which the server did not return.
+var ErrNotFetched = errors.New("Message was not returned by the server")
+
+//ErrMalformed is the error of a message which was fetched but could not be parsed.
+//Unlike other errors it is permanent, fetching the message again gives the same error.
+var ErrMalformed = errors.New("Message could not be parsed")
+
+//errorUIDs returns the UIDs of all errs.
+func errorUIDs(errs []UIDError) (uids []uint32) {
+	for _, e := range errs {
+		uids = append(uids, e.UIDs...)
+	}
+	return
+}
+
+//subtractUIDs returns the UIDs of all which are not in some.
+func subtractUIDs(all []uint32, some []uint32) (rest []uint32) {
+	in := make(map[uint32]bool, len(some))
+	for _, uid := range some {
+		in[uid] = true
+	}
+	for _, uid := range all {
+		if !in[uid] {
+			rest = append(rest, uid)
+		}
+	}
+	return
+}
@@ -0,0 +1,53 @@
+package Simap
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func Test_ResultErr(t *testing.T) {
+	res := new(Result)
+	res.add([]uint32{1, 2}, nil)
+	if err := res.err("Copying"); err != nil {
+		t.Fatalf("no failed jobs should give no error, got %v", err)
+	}
+	res.add([]uint32{3, 4}, ErrNotFetched)
+	res.add([]uint32{5}, nil)
+	if !reflect.DeepEqual(res.Succeeded, []uint32{1, 2, 5}) {
+		t.Errorf("Succeeded = %v", res.Succeeded)
+	}
+	if !reflect.DeepEqual(res.FailedUIDs(), []uint32{3, 4}) {
+		t.Errorf("FailedUIDs = %v", res.FailedUIDs())
+	}
+	err := res.err("Copying")
+	var be *BatchError
+	if !errors.As(err, &be) || be.Succeeded != 3 {
+		t.Fatalf("expected a *BatchError with 3 succeeded, got %v", err)
+	}
+	if !errors.Is(err, ErrNotFetched) {
+		t.Errorf("errors.Is should find the error of a failed job in %v", err)
+	}
+	var ue UIDError
+	if !errors.As(err, &ue) || !reflect.DeepEqual(ue.UIDs, []uint32{3, 4}) {
+		t.Errorf("errors.As should find the UIDError of the failed job, got %v", ue)
+	}
+}
+
+func Test_subtractUIDs(t *testing.T) {
+	rest := subtractUIDs([]uint32{1, 2, 3, 4}, []uint32{4, 2, 9})
+	if !reflect.DeepEqual(rest, []uint32{1, 3}) {
+		t.Errorf("subtractUIDs = %v, want [1 3]", rest)
+	}
+}
+
+func Test_splitModified(t *testing.T) {
+	res := new(Result)
+	res.splitModified([]uint32{1, 2, 3}, []uint32{2})
+	if !reflect.DeepEqual(res.Succeeded, []uint32{1, 3}) || !reflect.DeepEqual(res.FailedUIDs(), []uint32{2}) {
+		t.Errorf("Succeeded = %v, Failed = %v", res.Succeeded, res.FailedUIDs())
+	}
+	if !errors.Is(res.err("Marking"), ErrModified) {
+		t.Errorf("the modified UIDs should fail with ErrModified")
+	}
+}
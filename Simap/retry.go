@@ -0,0 +1,154 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//RetryPolicy tells how the jobs of an operation are retried after transient failures.
+//Before each retry the session dials and logs in again and selects the mailbox it had selected,
+//then only the failed job is run again, jobs which already finished are not repeated.
+//A command whose response was lost may still have been carried out by the server,
+//so a retried copy can leave duplicates in the destination mailbox. For that reason APPEND is never retried.
+type RetryPolicy struct {
+	//MaxAttempts is the number of times a job is tried in total, <= 1 means no retries.
+	MaxAttempts int
+	//Backoff is the delay before the first retry, it doubles for every further retry. 0 means 1s.
+	Backoff time.Duration
+	//MaxBackoff caps the delay between retries. 0 means 30s.
+	MaxBackoff time.Duration
+	//Jitter is the fraction of the delay, between 0 and 1, which is randomly taken off it
+	//so that many clients do not retry at the same time.
+	Jitter float64
+	//Retryable tells whether an error is worth retrying, nil means IsRetryable.
+	Retryable func(err error) bool
+}
+
+//IsRetryable reports whether err is a transient failure: a dropped connection, a timeout,
+//the server saying BYE or refusing a command with NO [UNAVAILABLE] or NO [INUSE].
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var rspErr imap.ResponseError
+	if errors.As(err, &rspErr) && rspErr.Response != nil {
+		switch {
+		case rspErr.Status == imap.BYE:
+			return true
+		case rspErr.Status == imap.NO:
+			label := strings.ToUpper(rspErr.Label)
+			return label == "UNAVAILABLE" || label == "INUSE"
+		}
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, imap.ErrTimeout)
+}
+
+//delay returns how long to wait before retry number attempt, counting from 1.
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	d, max := p.Backoff, p.MaxBackoff
+	if d <= 0 {
+		d = time.Second
+	}
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if errors.As(err, new(callbackError)) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+//callbackError wraps an error returned by a callback of the caller, such as the fn of StreamEMails.
+//It stops the operation even if it looks transient, the connection is fine.
+type callbackError struct {
+	err error
+}
+
+func (e callbackError) Error() string {
+	return e.err.Error()
+}
+
+func (e callbackError) Unwrap() error {
+	return e.err
+}
+
+//retry calls op until it succeeds or fails for good according to Options.Retry,
+//reconnecting the session before each retry.
+func (s *Session) retry(ctx context.Context, op func() error) (err error) {
+	var p *RetryPolicy
+	if s.acct.Options != nil {
+		p = s.acct.Options.Retry
+	}
+	err = op()
+	if p == nil {
+		return
+	}
+	for attempt := 1; attempt < p.MaxAttempts && err != nil && ctx.Err() == nil && p.retryable(err); attempt++ {
+		d := p.delay(attempt)
+		s.log.Warn("Retrying", "mailbox", s.mbox, "attempt", attempt+1, "delay", d, "error", err)
+		s.obs.emit(Event{Kind: EventRetry, Mailbox: s.mbox, Err: err})
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+		if err = s.reconnect(ctx); err != nil {
+			s.log.Warn("Could not reconnect", "error", err)
+			continue
+		}
+		err = op()
+	}
+	return
+}
+
+//reconnect replaces the connection of s by a new one with the same mailbox selected.
+func (s *Session) reconnect(ctx context.Context) (err error) {
+	if s.c == nil {
+		return ErrLoggedOut
+	}
+	mbox, readOnly := s.mbox, s.readOnly
+	n, err := NewSession(ctx, s.acct, s.skipCerti)
+	if err != nil {
+		return
+	}
+	s.c.Logout(0)
+	s.c = n.c
+	s.mbox = ""
+	s.qresync = false
+	if mbox != "" {
+		err = s.selectMbox(mbox, readOnly)
+	}
+	return
+}
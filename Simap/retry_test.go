@@ -0,0 +1,67 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func Test_IsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{io.EOF, true},
+		{fmt.Errorf("Fetching: %w", io.ErrUnexpectedEOF), true},
+		{imap.ErrTimeout, true},
+		{imap.ErrNotAllowed, false}, //Wrong state, trying again would not help
+		{context.Canceled, false},
+		{imap.ResponseError{Response: &imap.Response{Status: imap.BYE}}, true},
+		{imap.ResponseError{Response: &imap.Response{Status: imap.NO, Label: "UNAVAILABLE"}}, true},
+		{imap.ResponseError{Response: &imap.Response{Status: imap.NO, Label: "TRYCREATE"}}, false},
+		{imap.ResponseError{Response: &imap.Response{Status: imap.BAD}}, false},
+		{errors.New("No source provided"), false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func Test_RetryPolicyDelay(t *testing.T) {
+	p := &RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if got := p.delay(attempt + 1); got != want {
+			t.Errorf("delay(%d) = %v, want %v", attempt+1, got, want)
+		}
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.delay(1); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("delay with jitter 0.5 = %v, want between 50ms and 100ms", d)
+		}
+	}
+	if d := (&RetryPolicy{}).delay(1); d != time.Second {
+		t.Errorf("default first delay = %v, want 1s", d)
+	}
+}
+
+func Test_CallbackErrorNotRetried(t *testing.T) {
+	err := fmt.Errorf("Fetching: %w", callbackError{io.EOF})
+	if (&RetryPolicy{}).retryable(err) {
+		t.Errorf("an io.EOF returned by a callback should not be retried")
+	}
+	always := &RetryPolicy{Retryable: func(error) bool { return true }}
+	if always.retryable(err) {
+		t.Errorf("callback errors should not reach RetryPolicy.Retryable")
+	}
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("callbackError should unwrap to the error of the callback")
+	}
+}
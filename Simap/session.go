@@ -0,0 +1,687 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//Session is an authenticated connection to an IMAP server.
+//It is created once from an IMAPAccount and can then be used for any number of operations
+//without dialing and logging in again. A Session is not safe for concurrent use.
+type Session struct {
+	acct      *IMAPAccount
+	skipCerti bool
+
+	c    *imap.Client
+	pool []*Session //Additional connections of Options.Workers
+
+	mbox     string //Currently selected mailbox, "" if none
+	readOnly bool
+
+	ctx context.Context //Context of the running operation
+	log Logger
+	obs observer
+
+	special map[SpecialUse]string //Cache of SpecialMailboxes
+	delim   *string               //Cached hierarchy delimiter of the server
+	qresync bool                  //QRESYNC is enabled on c
+}
+
+//ErrLoggedOut is returned by the methods of a Session which has been logged out,
+//either by Logout or because the context of an operation was cancelled.
+var ErrLoggedOut = errors.New("Session is logged out")
+
+//abortTimeout is how long the server gets to answer LOGOUT when an operation is cancelled.
+const abortTimeout = 5 * time.Second
+
+//NewSession dials the IMAP server of acct and logs in.
+//IF skipCerti is true then it will not check for the validity of the Certificate of the IMAP server,
+//good only if IMAP server is using self signed certi.
+//ctx only bounds dialing and logging in.
+//The caller must call Logout when done with the session.
+func NewSession(ctx context.Context, acct *IMAPAccount, skipCerti bool) (s *Session, err error) {
+	l := acct.logger()
+	obs := acct.observer()
+	start := time.Now()
+	c, conn, secure, err := dial(ctx, acct.Server, skipCerti, obs.wrap())
+	obs.since(start, Event{Kind: EventConnect, Err: err})
+	if err != nil {
+		l.Error("Could not connect", "error", err)
+		return
+	}
+	if acct.Options != nil && acct.Options.Logger != nil {
+		setLogger(c, l)
+	}
+	if !secure && !acct.Server.AllowInsecureAuth {
+		c.Logout(abortTimeout)
+		err = ErrInsecureAuth
+		return
+	}
+	//LOGIN blocks until the server answers, closing the connection is the only way to interrupt it.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	start = time.Now()
+	_, err = login(c, acct)
+	if !stop() {
+		err = ctx.Err()
+	}
+	obs.since(start, Event{Kind: EventLogin, Err: err})
+	if err != nil {
+		l.Error("Could not log in", "error", err)
+		c.Logout(abortTimeout)
+		return
+	}
+	l.Info("Logged in")
+	s = &Session{acct: acct, skipCerti: skipCerti, c: c, log: l, obs: obs}
+	return
+}
+
+//Client returns the underlying imap client of the session.
+func (s *Session) Client() *imap.Client {
+	return s.c
+}
+
+//Mailbox returns the name of the currently selected mailbox or "" if none is selected.
+func (s *Session) Mailbox() string {
+	return s.mbox
+}
+
+//Logout closes the selected mailbox if any and logs out from the server.
+func (s *Session) Logout() (err error) {
+	s.closeWorkers(false)
+	if s.c == nil {
+		return
+	}
+	if s.mbox != "" {
+		s.ctx = context.Background()
+		err = s.closeMbox()
+	}
+	s.c.Logout(-1)
+	s.c = nil
+	return
+}
+
+//abort logs out without waiting for the commands in progress.
+func (s *Session) abort() {
+	s.closeWorkers(true)
+	if s.c == nil {
+		return
+	}
+	s.c.Logout(abortTimeout)
+	s.c = nil
+	s.mbox = ""
+}
+
+//begin is called at the start of every operation, the commands of the operation are bound to ctx.
+func (s *Session) begin(ctx context.Context) error {
+	if s.c == nil {
+		return ErrLoggedOut
+	}
+	s.ctx = ctx
+	s.drain()
+	return ctx.Err()
+}
+
+//end is deferred by every operation. If ctx was cancelled while the operation was running
+//then the session is logged out and *err is replaced by ctx.Err().
+func (s *Session) end(ctx context.Context, err *error) {
+	s.drain()
+	if *err == nil || ctx.Err() == nil || *err == ErrLoggedOut {
+		return
+	}
+	*err = ctx.Err()
+	s.abort()
+}
+
+//drain discards the unilateral responses which the imap package keeps in the Data of the connections,
+//so that they do not pile up on long-lived sessions. The imap package has already applied them
+//to the status of the selected mailbox, operations needing them handle them right after their commands.
+func (s *Session) drain() {
+	for _, w := range append([]*Session{s}, s.pool...) {
+		if w.c == nil || len(w.c.Data) == 0 {
+			continue
+		}
+		s.log.Debug("Discarding unilateral responses", "responses", len(w.c.Data))
+		w.c.Data = nil
+	}
+}
+
+//wait is WaitRespContext for the commands of the running operation.
+func (s *Session) wait(cmd *imap.Command, err error) error {
+	_, _, err = s.result(cmd, err)
+	return err
+}
+
+//result is wait also returning the tagged response completing cmd
+//and the responses cmd received before completing.
+func (s *Session) result(cmd *imap.Command, err error) (rsp *imap.Response, data []*imap.Response, err1 error) {
+	rsp, err = s.stream(cmd, err, func(rsp *imap.Response) { data = append(data, rsp) })
+	return rsp, data, err
+}
+
+//stream is result passing the responses cmd receives to data as they arrive instead of collecting them,
+//for commands such as UID FETCH receiving more than should be held in memory.
+func (s *Session) stream(cmd *imap.Command, err error, data func(rsp *imap.Response)) (rsp *imap.Response, err1 error) {
+	if err != nil {
+		return nil, err
+	}
+	finished := s.commandStarted(cmd)
+	rsp, err = waitResp(s.ctx, cmd, err, s.log, data)
+	finished(err)
+	return rsp, err
+}
+
+//commandStarted sends the EventCommandStart of cmd and returns the function sending its EventCommandFinish.
+func (s *Session) commandStarted(cmd *imap.Command) (finished func(err error)) {
+	if s.obs.o == nil {
+		return func(error) {}
+	}
+	name := cmd.Name(true)
+	s.obs.emit(Event{Kind: EventCommandStart, Mailbox: s.mbox, Command: name})
+	start := time.Now()
+	return func(err error) {
+		s.obs.since(start, Event{Kind: EventCommandFinish, Mailbox: s.mbox, Command: name, Err: err})
+	}
+}
+
+//searchUIDs returns the UIDs of the messages of the selected mailbox matching query.
+func (s *Session) searchUIDs(query string) (uids []uint32, err error) {
+	_, data, err := s.result(s.c.UIDSearch(query))
+	for _, rsp := range data {
+		if rsp.Label == "SEARCH" {
+			uids = rsp.SearchResults()
+		}
+	}
+	return
+}
+
+//fetchMessages is FetchMessagesFunc for the session, also passing the UIDs of the messages which can not be parsed to bad.
+func (s *Session) fetchMessages(uids []uint32, fn func(MsgData) error, bad func(uid uint32, err error)) (err error) {
+	var errFn error
+	cmd, err := s.c.UIDFetch(uidSet(uids), "RFC822")
+	_, err = s.stream(cmd, err, deliverFetched(fn, bad, &errFn))
+	if errFn != nil {
+		err = errFn
+	}
+	return
+}
+
+//selectMbox selects mailbox name unless it is already selected.
+//A mailbox selected read-write is reused for read-only access.
+func (s *Session) selectMbox(name string, readOnly bool) (err error) {
+	if s.mbox == name && (readOnly || !s.readOnly) {
+		return
+	}
+	s.mbox = ""
+	start := time.Now()
+	err = s.wait(s.c.Select(name, readOnly))
+	s.obs.since(start, Event{Kind: EventSelect, Mailbox: name, Err: err})
+	if err != nil {
+		return
+	}
+	s.mbox = name
+	s.readOnly = readOnly
+	return
+}
+
+//closeMbox closes the currently selected mailbox without expunging it.
+func (s *Session) closeMbox() (err error) {
+	s.mbox = ""
+	return s.wait(s.c.Close(false))
+}
+
+//ensureMbox creates mailbox name if it does not exist yet, subscribing the mailboxes it creates if subscribe is true.
+func (s *Session) ensureMbox(name string, subscribe bool) (err error) {
+	exists, err := s.mboxExists(name)
+	if err != nil || exists {
+		return
+	}
+	if err = s.createParents(name, subscribe); err != nil {
+		return
+	}
+	return s.create(name, subscribe)
+}
+
+//create creates mailbox name, subscribing it if subscribe is true.
+func (s *Session) create(name string, subscribe bool) (err error) {
+	s.special = nil //The new mailbox may have a role
+	if err = s.wait(s.c.Create(name)); err != nil {
+		return
+	}
+	if subscribe {
+		err = s.wait(s.c.Subscribe(name))
+	}
+	return
+}
+
+//CreateMbox creates a mailbox/folder on the server along with its missing parent folders.
+//If already exists then do nothing
+//If subscribe is true the mailboxes it creates, the parent folders included, are also subscribed.
+//Mailboxes created on the fly when copying, moving or appending to a missing mailbox are not subscribed.
+func (s *Session) CreateMbox(ctx context.Context, name string, subscribe bool) (err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	return s.ensureMbox(name, subscribe)
+}
+
+//DeleteMbox deletes a mailbox/folder on the server
+//If does not exist then do nothing
+//The mailboxes below it are left alone, see DeleteMboxTree.
+func (s *Session) DeleteMbox(ctx context.Context, name string) (err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	exists, err := s.mboxExists(name)
+	if err != nil || !exists {
+		return
+	}
+	if s.mbox == name {
+		if err = s.closeMbox(); err != nil {
+			return
+		}
+	}
+	s.special = nil
+	err = s.wait(s.c.Delete(name))
+	return
+}
+
+//CopyEmails copies Emails having unique identifiers uids (NOT sequence numbers) of mailbox src
+//to mailbox dst by making bunches of jobsize.
+//If dst mbox doesnt exist then it will create it.
+//res lists the UIDs which were copied and those which failed with their errors,
+//err is a *BatchError if any failed.
+func (s *Session) CopyEmails(ctx context.Context, src string, dst string, uids []uint32, jobSize int) (res *Result, err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+
+	if src == "" {
+		err = errors.New("No source provided")
+		return
+	}
+	if dst == "" {
+		err = errors.New("No Dst provided")
+		return
+	}
+
+	err = s.retry(ctx, func() error { return s.ensureMbox(dst, false) })
+	if err != nil {
+		return
+	}
+
+	err = s.retry(ctx, func() error { return s.selectMbox(src, true) })
+	if err != nil {
+		return
+	}
+
+	timestarted := time.Now()
+
+	jobs := makeJobs(uids, jobSize)
+	res = new(Result)
+	mappings := make([]uidMapping, len(jobs))
+
+	s.log.Info("Copying", "mailbox", src, "to", dst, "uids", len(uids), "jobs", len(jobs), "jobSize", jobSize)
+
+	err = s.runJobs(ctx, "Copying", src, true, jobs, func(w *Session, i int) error {
+		w.log.Debug("Copying job", "mailbox", src, "uids", len(jobs[i]))
+		var err1 error
+		mappings[i], err1 = w.copyJob(jobs[i], dst, false)
+		return err1
+	}, func(i int, err1 error) error {
+		if err1 != nil {
+			s.log.Warn("Job failed", "mailbox", src, "uids", len(jobs[i]), "error", err1)
+		}
+		res.add(jobs[i], err1)
+		res.addMapping(mappings[i])
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	s.logFinished("Copying", len(uids), timestarted)
+	err = res.err("Copying")
+	return
+}
+
+//MoveEmails is similar to CopyEmails but it moves the mails to dst hence deleting mails from src.
+//It uses the best MoveStrategy the server supports and reports it in res.Strategy.
+func (s *Session) MoveEmails(ctx context.Context, src string, dst string, uids []uint32, jobSize int) (res *Result, err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+
+	if src == "" {
+		err = errors.New("No source provided")
+		return
+	}
+	if dst == "" {
+		err = errors.New("No Dst provided")
+		return
+	}
+
+	err = s.retry(ctx, func() error { return s.ensureMbox(dst, false) })
+	if err != nil {
+		return
+	}
+
+	err = s.retry(ctx, func() error { return s.selectMbox(src, false) })
+	if err != nil {
+		return
+	}
+
+	timestarted := time.Now()
+
+	jobs := makeJobs(uids, jobSize)
+	res = new(Result)
+	res.Strategy = chooseMoveStrategy(s.c.Caps)
+	mappings := make([]uidMapping, len(jobs))
+	copied := make([]bool, len(jobs)) //Jobs not to copy again when expunging them is retried
+
+	s.log.Info("Moving", "mailbox", src, "to", dst, "uids", len(uids), "jobs", len(jobs), "jobSize", jobSize, "strategy", res.Strategy)
+	if res.Strategy == MoveCopyExpunge {
+		s.log.Warn("Server supports neither MOVE nor UIDPLUS, other messages flagged \\Deleted will be expunged too", "mailbox", src)
+	}
+
+	err = s.runJobs(ctx, "Moving", src, false, jobs, func(w *Session, i int) error {
+		w.log.Debug("Moving job", "mailbox", src, "uids", len(jobs[i]))
+		var err1 error
+		if res.Strategy == MoveUIDMove {
+			mappings[i], err1 = w.copyJob(jobs[i], dst, true)
+			return err1
+		}
+		if !copied[i] {
+			mappings[i], err1 = w.copyJob(jobs[i], dst, false)
+			if err1 != nil {
+				return err1
+			}
+			copied[i] = true
+		}
+		err1 = w.expungeUIDs(uidSet(jobs[i]))
+		if err1 != nil {
+			err1 = fmt.Errorf("Expunge: %w", err1)
+		}
+		return err1
+	}, func(i int, err1 error) error {
+		if err1 != nil {
+			s.log.Warn("Job failed", "mailbox", src, "uids", len(jobs[i]), "error", err1)
+		}
+		res.add(jobs[i], err1)
+		res.addMapping(mappings[i])
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	s.logFinished("Moving", len(uids), timestarted)
+	err = res.err("Moving")
+	return
+}
+
+//DeleteEmails deletes mails having uids from src.Arguments have same meaning as CopyEmails
+//If the server supports UIDPLUS only these mails are expunged, otherwise the server expunges
+//every mail of src flagged \Deleted, including those flagged by other clients.
+func (s *Session) DeleteEmails(ctx context.Context, src string, uids []uint32, jobSize int) (res *Result, err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+
+	if src == "" {
+		err = errors.New("No source provided")
+		return
+	}
+
+	err = s.retry(ctx, func() error { return s.selectMbox(src, false) })
+	if err != nil {
+		return
+	}
+
+	timestarted := time.Now()
+
+	jobs := makeJobs(uids, jobSize)
+	res = new(Result)
+
+	s.log.Info("Deleting", "mailbox", src, "uids", len(uids), "jobs", len(jobs), "jobSize", jobSize)
+	if !s.c.Caps["UIDPLUS"] {
+		s.log.Warn("Server does not support UIDPLUS, other messages flagged \\Deleted will be expunged too", "mailbox", src)
+	}
+
+	err = s.runJobs(ctx, "Deleting", src, false, jobs, func(w *Session, i int) error {
+		w.log.Debug("Deleting job", "mailbox", src, "uids", len(jobs[i]))
+		return w.expungeUIDs(uidSet(jobs[i]))
+	}, func(i int, err1 error) error {
+		if err1 != nil {
+			s.log.Warn("Job failed", "mailbox", src, "uids", len(jobs[i]), "error", err1)
+		}
+		res.add(jobs[i], err1)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	s.logFinished("Deleting", len(uids), timestarted)
+	err = res.err("Deleting")
+	return
+}
+
+//expungeUIDs flags the messages in uidSet as \Deleted and expunges them.
+//Without UIDPLUS the server can only be told to expunge all messages flagged \Deleted.
+func (s *Session) expungeUIDs(uidSet *imap.SeqSet) (err error) {
+	err = s.wait(s.c.UIDStore(uidSet, "+FLAGS.SILENT", imap.NewFlagSet(`\Deleted`)))
+	if err != nil {
+		return
+	}
+	if !s.c.Caps["UIDPLUS"] {
+		uidSet = nil
+	}
+	return s.wait(s.c.Expunge(uidSet))
+}
+
+//MarkEmails marks mails having uids from src with IMAP flag specified in imapFlag.
+//See RFC 3501 section 2.3.2 for a list of all valid flags.
+func (s *Session) MarkEmails(ctx context.Context, src string, imapFlag string, uids []uint32, jobSize int) (res *Result, err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	return s.storeFlags("Marking", "+FLAGS.SILENT", src, imapFlag, uids, 0, jobSize)
+}
+
+//UnMarkEmails unmarks/resets flags of mails having uids from src with IMAP flag specified in imapFlag.
+//See RFC 3501 section 2.3.2 for a list of all valid flags.
+func (s *Session) UnMarkEmails(ctx context.Context, src string, imapFlag string, uids []uint32, jobSize int) (res *Result, err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	return s.storeFlags("UnMarking", "-FLAGS.SILENT", src, imapFlag, uids, 0, jobSize)
+}
+
+//storeFlags stores imapFlag with item on the messages with uids, if modSeq is not 0 only on those unchanged since modSeq.
+func (s *Session) storeFlags(action string, item string, src string, imapFlag string, uids []uint32, modSeq uint64, jobSize int) (res *Result, err error) {
+
+	if src == "" {
+		err = errors.New("No source provided")
+		return
+	}
+
+	err = s.retry(s.ctx, func() error { return s.selectMbox(src, false) })
+	if err != nil {
+		return
+	}
+
+	timestarted := time.Now()
+
+	jobs := makeJobs(uids, jobSize)
+	res = new(Result)
+
+	s.log.Info(action, "mailbox", src, "flag", imapFlag, "uids", len(uids), "jobs", len(jobs), "jobSize", jobSize)
+
+	modified := make([][]uint32, len(jobs))
+	err = s.runJobs(s.ctx, action, src, false, jobs, func(w *Session, i int) (err error) {
+		w.log.Debug(action+" job", "mailbox", src, "uids", len(jobs[i]))
+		if modSeq == 0 {
+			return w.wait(w.c.UIDStore(uidSet(jobs[i]), item, imap.NewFlagSet(imapFlag)))
+		}
+		modified[i], err = w.storeUnchangedSince(jobs[i], item, imapFlag, modSeq)
+		return
+	}, func(i int, err1 error) error {
+		if err1 != nil {
+			s.log.Warn("Job failed", "mailbox", src, "uids", len(jobs[i]), "error", err1)
+		}
+		if err1 == nil && len(modified[i]) > 0 {
+			s.log.Info("Messages modified meanwhile", "mailbox", src, "uids", len(modified[i]))
+			res.splitModified(jobs[i], modified[i])
+			return nil
+		}
+		res.add(jobs[i], err1)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	s.logFinished(action, len(uids), timestarted)
+	err = res.err(action)
+	return
+}
+
+//GetEMails gets Emails from mailbox mbox in Struct of Type MsgData.
+//It searches the mailbox for messages that match the given searching criteria mentioned in query string.
+//See RFC 3501 section 6.4.4 for a list of all valid search keys.
+//It is the caller's responsibility to quote strings when necessary.
+//All strings must use UTF-8 encoding.
+//If some Emails could not be fetched the others are still returned along with a *BatchError listing the failed UIDs.
+func (s *Session) GetEMails(ctx context.Context, query string, mbox string, jobSize int) (mails []MsgData, err error) {
+	err = s.StreamEMails(ctx, query, mbox, jobSize, func(msg MsgData) error {
+		mails = append(mails, msg)
+		return nil
+	})
+	return
+}
+
+//StreamEMails is like GetEMails but calls fn for each Email as soon as it is fetched instead of returning all of them.
+//The next Email is not read from the server before fn returns.
+//If fn returns an error then fetching stops and that error is returned.
+//If some Emails could not be fetched the error is a *BatchError listing their UIDs.
+func (s *Session) StreamEMails(ctx context.Context, query string, mbox string, jobSize int, fn func(MsgData) error) (err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+
+	if mbox == "" {
+		mbox = "inbox"
+	}
+	var uids []uint32
+	err = s.retry(ctx, func() (err error) {
+		if err = s.selectMbox(mbox, true); err != nil {
+			return
+		}
+		uids, err = s.searchUIDs(query)
+		return
+	})
+	if err != nil {
+		return
+	}
+	_, err = s.fetchUIDs(ctx, mbox, uids, jobSize, fn)
+	return
+}
+
+//fetchUIDs passes the messages with uids of the selected mailbox mbox to fn as StreamEMails does.
+//res tells which messages were passed to fn, also when fetching stopped early.
+func (s *Session) fetchUIDs(ctx context.Context, mbox string, uids []uint32, jobSize int, fn func(MsgData) error) (res *Result, err error) {
+	timestarted := time.Now()
+
+	jobs := makeJobs(uids, jobSize)
+
+	s.log.Info("Fetching", "mailbox", mbox, "uids", len(uids), "jobs", len(jobs), "jobSize", jobSize)
+
+	//With several workers each job is fetched into its batch and passed to fn by runJobs,
+	//a single connection streams straight to fn.
+	var batches [][]MsgData
+	if s.acct.Options != nil && s.acct.Options.Workers > 1 {
+		batches = make([][]MsgData, len(jobs))
+	}
+	res = new(Result)
+	var errFn error
+	var fetched []uint32 //UIDs of the job passed to fn
+	deliver := func(msg MsgData) error {
+		if errFn = fn(msg); errFn != nil {
+			return callbackError{errFn}
+		}
+		fetched = append(fetched, msg.Imap_uid)
+		return nil
+	}
+	//Messages which can not be parsed are reported per job instead of being fetched again and again
+	malformed := make([][]UIDError, len(jobs))
+	bad := func(i int) func(uid uint32, err error) {
+		return func(uid uint32, err error) {
+			malformed[i] = append(malformed[i], UIDError{[]uint32{uid}, err})
+		}
+	}
+	err = s.runJobs(ctx, "Fetching", mbox, true, jobs, func(w *Session, i int) error {
+		if batches == nil { //Messages already passed to fn are not fetched again on retries
+			rest := subtractUIDs(subtractUIDs(jobs[i], fetched), errorUIDs(malformed[i]))
+			if len(rest) == 0 {
+				return nil
+			}
+			return w.fetchMessages(rest, deliver, bad(i))
+		}
+		batches[i], malformed[i] = nil, nil
+		return w.fetchMessages(jobs[i], func(msg MsgData) error {
+			batches[i] = append(batches[i], msg)
+			return nil
+		}, bad(i))
+	}, func(i int, errF error) error {
+		if errFn != nil {
+			res.add(fetched, nil)
+			return errFn
+		}
+		if errF != nil {
+			s.log.Warn("Job failed", "mailbox", mbox, "uids", len(jobs[i]), "error", errF)
+		}
+		if batches != nil {
+			for _, msg := range batches[i] {
+				if deliver(msg) != nil {
+					res.add(fetched, nil)
+					return errFn
+				}
+			}
+			batches[i] = nil
+		}
+		res.add(fetched, nil)
+		for _, m := range malformed[i] {
+			s.log.Warn("Skipping malformed message", "mailbox", mbox, "uid", m.UIDs[0], "error", m.Err)
+			res.add(m.UIDs, m.Err)
+		}
+		if missing := subtractUIDs(subtractUIDs(jobs[i], fetched), errorUIDs(malformed[i])); len(missing) > 0 {
+			if errF == nil {
+				errF = ErrNotFetched
+			}
+			res.add(missing, errF)
+		}
+		fetched, malformed[i] = fetched[:0], nil
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	s.logFinished("Fetching", len(uids), timestarted)
+	err = res.err("Fetching")
+	return
+}
+
+func (s *Session) logFinished(action string, n int, timestarted time.Time) {
+	timeelapsed := time.Since(timestarted)
+	msecpermessage := timeelapsed.Seconds() / float64(n) * 1000
+	messagespersec := float64(n) / timeelapsed.Seconds()
+	s.log.Info("Finished "+action, "uids", n, "seconds", timeelapsed.Seconds(), "msPerMessage", msecpermessage, "messagesPerSecond", messagespersec)
+}
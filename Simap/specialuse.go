@@ -0,0 +1,200 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+//SpecialUse is the role of a mailbox, RFC 6154.
+type SpecialUse string
+
+const (
+	SpecialAll     SpecialUse = `\All`
+	SpecialArchive SpecialUse = `\Archive`
+	SpecialDrafts  SpecialUse = `\Drafts`
+	SpecialFlagged SpecialUse = `\Flagged`
+	SpecialJunk    SpecialUse = `\Junk`
+	SpecialSent    SpecialUse = `\Sent`
+	SpecialTrash   SpecialUse = `\Trash`
+)
+
+//ErrNoSpecialMailbox is returned by SpecialMailbox when no mailbox has the requested role.
+var ErrNoSpecialMailbox = errors.New("No mailbox found for this special use")
+
+//specialAttrs maps the attributes of LIST with SPECIAL-USE and of XLIST to roles.
+var specialAttrs = map[string]SpecialUse{
+	`\all`:     SpecialAll,
+	`\allmail`: SpecialAll, //XLIST
+	`\archive`: SpecialArchive,
+	`\drafts`:  SpecialDrafts,
+	`\flagged`: SpecialFlagged,
+	`\starred`: SpecialFlagged, //XLIST
+	`\junk`:    SpecialJunk,
+	`\spam`:    SpecialJunk, //XLIST
+	`\sent`:    SpecialSent,
+	`\trash`:   SpecialTrash,
+}
+
+//specialNames are the usual names of the mailboxes of each role in lower case, also localized,
+//for servers which support neither SPECIAL-USE nor XLIST. Earlier names are preferred.
+var specialNames = map[SpecialUse][]string{
+	SpecialAll:     {"all mail", "alle nachrichten", "tous les messages", "todos"},
+	SpecialArchive: {"archive", "archives", "archiv", "archivo", "archivio", "archief"},
+	SpecialDrafts:  {"drafts", "draft", "entwürfe", "brouillons", "borradores", "bozze", "concepten", "черновики"},
+	SpecialFlagged: {"flagged", "starred", "markiert", "suivis"},
+	SpecialJunk:    {"junk", "junk e-mail", "junk email", "spam", "bulk mail", "spamverdacht", "courrier indésirable", "correo no deseado", "posta indesiderata", "ongewenste e-mail", "спам"},
+	SpecialSent: {"sent", "sent items", "sent messages", "sent mail", "gesendet", "gesendete elemente", "gesendete objekte",
+		"envoyés", "éléments envoyés", "enviados", "elementos enviados", "posta inviata", "inviata", "verzonden", "verzonden items", "отправленные"},
+	SpecialTrash: {"trash", "deleted items", "deleted messages", "bin", "papierkorb", "gelöschte elemente", "gelöschte objekte",
+		"corbeille", "éléments supprimés", "papelera", "elementos eliminados", "cestino", "prullenbak", "verwijderde items", "корзина"},
+}
+
+//SpecialMailboxes finds the mailboxes of each role, e.g. the trash or sent mailbox.
+//It uses the attributes of LIST if the server supports SPECIAL-USE, XLIST if the server supports it,
+//and otherwise guesses from the usual names of such mailboxes in several languages.
+//The result is cached for the session until the session creates, renames or deletes a mailbox;
+//each call returns a copy which the caller may modify.
+func (s *Session) SpecialMailboxes(ctx context.Context) (roles map[SpecialUse]string, err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	if s.special == nil {
+		var mboxes []MboxInfo
+		err = s.retry(ctx, func() (err error) {
+			switch {
+			case s.c.Caps["SPECIAL-USE"]:
+				mboxes, err = s.specialList()
+			case s.c.Caps["XLIST"]:
+				mboxes, err = s.xlist()
+			default:
+				mboxes, err = s.list("", "*")
+			}
+			return
+		})
+		if err != nil {
+			return
+		}
+		s.special = specialRoles(mboxes)
+	}
+	roles = make(map[SpecialUse]string, len(s.special))
+	for use, name := range s.special {
+		roles[use] = name
+	}
+	return
+}
+
+//SpecialMailbox returns the name of the mailbox with role use, see SpecialMailboxes.
+func (s *Session) SpecialMailbox(ctx context.Context, use SpecialUse) (name string, err error) {
+	roles, err := s.SpecialMailboxes(ctx)
+	if err != nil {
+		return
+	}
+	name, ok := roles[use]
+	if !ok {
+		err = ErrNoSpecialMailbox
+	}
+	return
+}
+
+//specialRoles maps roles to the mailboxes having them by attribute, or else by name.
+func specialRoles(mboxes []MboxInfo) (roles map[SpecialUse]string) {
+	roles = make(map[SpecialUse]string)
+	for _, m := range mboxes {
+		for _, attr := range m.Attrs {
+			if use, ok := specialAttrs[strings.ToLower(attr)]; ok {
+				if _, found := roles[use]; !found {
+					roles[use] = m.Name
+				}
+			}
+		}
+	}
+	for use, names := range specialNames {
+		if _, found := roles[use]; found {
+			continue
+		}
+		best := len(names)
+		for _, m := range mboxes {
+			if m.HasAttr(`\Noselect`) || m.HasAttr(`\NonExistent`) {
+				continue
+			}
+			leaf := strings.ToLower(m.Name)
+			if m.Delim != "" {
+				leaf = leaf[strings.LastIndex(leaf, strings.ToLower(m.Delim))+1:]
+			}
+			for i, name := range names[:best] {
+				if leaf == name {
+					roles[use] = m.Name
+					best = i
+					break
+				}
+			}
+		}
+	}
+	return
+}
+
+//specialList lists all mailboxes with LIST "" "*" RETURN (SPECIAL-USE), RFC 6154 section 5.1,
+//as servers need not return the special-use attributes to a plain LIST.
+func (s *Session) specialList() (mboxes []MboxInfo, err error) {
+	_, data, err := s.result(s.c.Send("LIST", s.c.Quote(""), s.c.Quote("*"), "RETURN", []imap.Field{"SPECIAL-USE"}))
+	if err != nil {
+		return
+	}
+	for _, rsp := range data {
+		if rsp.Label == "LIST" {
+			mboxes = append(mboxes, mboxInfo(rsp.MailboxInfo()))
+		}
+	}
+	return
+}
+
+//xlist lists all mailboxes with the XLIST command of Gmail, predecessor of SPECIAL-USE.
+func (s *Session) xlist() (mboxes []MboxInfo, err error) {
+	if s.c.CommandConfig["XLIST"] == nil { //Unknown to the imap package
+		s.c.CommandConfig["XLIST"] = &imap.CommandConfig{
+			States: s.c.CommandConfig["LIST"].States,
+			Filter: imap.LabelFilter("XLIST"),
+		}
+	}
+	_, data, err := s.result(s.c.Send("XLIST", s.c.Quote(""), s.c.Quote("*")))
+	if err != nil {
+		return
+	}
+	for _, rsp := range data {
+		if m, ok := parseListFields("XLIST", rsp.Fields); ok {
+			mboxes = append(mboxes, m)
+		}
+	}
+	return
+}
+
+//parseListFields parses the fields of an untagged LIST-like response with label:
+//(attributes) delimiter name.
+func parseListFields(label string, fields []imap.Field) (m MboxInfo, ok bool) {
+	if len(fields) > 0 && imap.TypeOf(fields[0]) == imap.Atom && strings.EqualFold(imap.AsAtom(fields[0]), label) {
+		fields = fields[1:]
+	}
+	if len(fields) != 3 || imap.TypeOf(fields[0]) != imap.List {
+		return
+	}
+	info := &imap.MailboxInfo{Attrs: imap.AsFlagSet(fields[0]), Delim: fieldString(fields[1])}
+	info.Name = fieldString(fields[2])
+	if name, err := imap.UTF7Decode(info.Name); err == nil {
+		info.Name = name
+	}
+	return mboxInfo(info), true
+}
+
+//fieldString returns the text of an atom or string field, "" for NIL.
+func fieldString(f imap.Field) string {
+	switch imap.TypeOf(f) {
+	case imap.Atom:
+		return imap.AsAtom(f)
+	case imap.QuotedString, imap.LiteralString:
+		return imap.AsString(f)
+	}
+	return ""
+}
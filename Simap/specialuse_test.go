@@ -0,0 +1,47 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_specialRoles(t *testing.T) {
+	mboxes := []MboxInfo{
+		{Name: "INBOX", Delim: "/"},
+		{Name: "[Gmail]", Delim: "/", Attrs: []string{`\Noselect`}},
+		{Name: "[Gmail]/All Mail", Delim: "/", Attrs: []string{`\AllMail`}},
+		{Name: "[Gmail]/Bin", Delim: "/", Attrs: []string{`\Trash`}},
+		{Name: "Trash", Delim: "/"},
+		{Name: "INBOX/Sent", Delim: "/"},
+		{Name: "Sent Items", Delim: "/"},
+		{Name: "Entwürfe", Delim: "/"},
+		{Name: "Spam", Delim: "/", Attrs: []string{`\Noselect`}},
+	}
+	want := map[SpecialUse]string{
+		SpecialAll:    "[Gmail]/All Mail",
+		SpecialTrash:  "[Gmail]/Bin",
+		SpecialSent:   "INBOX/Sent",
+		SpecialDrafts: "Entwürfe",
+	}
+	if got := specialRoles(mboxes); !reflect.DeepEqual(got, want) {
+		t.Errorf("specialRoles = %v, want %v", got, want)
+	}
+}
+
+func Test_parseListFieldsUTF7(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Entw&APw-rfe", "Entwürfe"},
+		{"&ZeVnLIqe-", "日本語"},
+		{"Archive/2024", "Archive/2024"},
+	}
+	for _, tt := range tests {
+		m, ok := parseListFields("XLIST", []imap.Field{"XLIST", []imap.Field{`\HasNoChildren`}, "/", tt.name})
+		if !ok || m.Name != tt.want {
+			t.Errorf("parseListFields(%q) = %q, %v, want %q", tt.name, m.Name, ok, tt.want)
+		}
+	}
+}
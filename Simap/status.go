@@ -0,0 +1,171 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//MboxStatus holds the counters of a mailbox returned by STATUS, RFC 3501 section 6.3.10.
+type MboxStatus struct {
+	Name          string
+	Messages      uint32
+	Recent        uint32
+	Unseen        uint32
+	UIDNext       uint32
+	UIDValidity   uint32
+	HighestModSeq uint64 //0 if the server does not support CONDSTORE
+	Size          uint64 //Total size of the messages in bytes, 0 if the server does not support STATUS=SIZE
+}
+
+//MailboxStatus returns the status of each of the mailboxes names without selecting them.
+//If some mailboxes fail, for example because they do not exist, the status of the others is still returned
+//along with an error for each failed mailbox.
+func (s *Session) MailboxStatus(ctx context.Context, names ...string) (statuses []MboxStatus, err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	items := []string{"MESSAGES", "RECENT", "UNSEEN", "UIDNEXT", "UIDVALIDITY"}
+	if condStore(s.c.Caps) {
+		items = append(items, "HIGHESTMODSEQ")
+	}
+	if s.c.Caps["STATUS=SIZE"] {
+		items = append(items, "SIZE")
+	}
+	var errs []error
+	for _, name := range names {
+		var st MboxStatus
+		errS := s.retry(ctx, func() (err error) {
+			st, err = s.status(name, items...)
+			return
+		})
+		if ctx.Err() != nil {
+			return statuses, ctx.Err()
+		}
+		if errS != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, errS))
+			continue
+		}
+		st.Name = name
+		statuses = append(statuses, st)
+	}
+	err = errors.Join(errs...)
+	return
+}
+
+//status returns the STATUS items of mailbox name.
+//STATUS should not be used on the selected mailbox, RFC 3501 section 6.3.10, so its status is taken from
+//the selected mailbox instead or, for the items this cannot tell, the mailbox is closed first.
+func (s *Session) status(name string, items ...string) (st MboxStatus, err error) {
+	if name == s.mbox && s.c.Mailbox != nil {
+		if selectedItems(items) {
+			return s.selectedStatus(name)
+		}
+		if err = s.closeMbox(); err != nil {
+			return
+		}
+	}
+	_, data, err := s.result(s.c.Status(name, items...))
+	if err != nil {
+		return
+	}
+	for _, rsp := range data {
+		if rsp.Label == "STATUS" {
+			return parseStatus(rsp.Fields)
+		}
+	}
+	err = errors.New("Server sent no STATUS response")
+	return
+}
+
+//selectedItems tells whether selectedStatus gives all STATUS items.
+func selectedItems(items []string) bool {
+	for _, item := range items {
+		switch strings.ToUpper(item) {
+		case "MESSAGES", "RECENT", "UNSEEN", "UIDNEXT", "UIDVALIDITY":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+//selectedStatus returns the status of the selected mailbox name without STATUS.
+//The counters of the selected mailbox are refreshed with NOOP, unseen messages are counted with UID SEARCH
+//and UIDNEXT is raised past the UID of the last message, which may have arrived after selecting.
+func (s *Session) selectedStatus(name string) (st MboxStatus, err error) {
+	if err = s.wait(s.c.Noop()); err != nil {
+		return
+	}
+	mb := s.c.Mailbox
+	st = MboxStatus{Name: name, Messages: mb.Messages, Recent: mb.Recent, UIDNext: mb.UIDNext, UIDValidity: mb.UIDValidity}
+	unseen, err := s.searchUIDs("UNSEEN")
+	if err != nil {
+		return
+	}
+	st.Unseen = uint32(len(unseen))
+	if st.Messages == 0 {
+		return
+	}
+	last, err := s.searchUIDs("UID *")
+	for _, uid := range last {
+		if uid >= st.UIDNext {
+			st.UIDNext = uid + 1
+		}
+	}
+	return
+}
+
+//parseStatus parses the fields of an untagged STATUS response: name (item value ...).
+func parseStatus(fields []imap.Field) (st MboxStatus, err error) {
+	if len(fields) > 0 && imap.TypeOf(fields[0]) == imap.Atom && strings.EqualFold(imap.AsAtom(fields[0]), "STATUS") {
+		fields = fields[1:]
+	}
+	if len(fields) != 2 || imap.TypeOf(fields[1]) != imap.List {
+		err = errors.New("Invalid STATUS response")
+		return
+	}
+	list := imap.AsList(fields[1])
+	for i := 0; i+1 < len(list); i += 2 {
+		if t := imap.TypeOf(list[i+1]); t != imap.Number && t != imap.Atom {
+			continue
+		}
+		var n uint64
+		if n, err = fieldNumber(list[i+1]); err != nil {
+			return
+		}
+		switch strings.ToUpper(imap.AsAtom(list[i])) {
+		case "MESSAGES":
+			st.Messages = uint32(n)
+		case "RECENT":
+			st.Recent = uint32(n)
+		case "UNSEEN":
+			st.Unseen = uint32(n)
+		case "UIDNEXT":
+			st.UIDNext = uint32(n)
+		case "UIDVALIDITY":
+			st.UIDValidity = uint32(n)
+		case "HIGHESTMODSEQ":
+			st.HighestModSeq = n
+		case "SIZE":
+			st.Size = n
+		}
+	}
+	return
+}
+
+//fieldNumber returns the number of field f, which is an atom for numbers beyond 32 bits such as mod-sequences.
+func fieldNumber(f imap.Field) (n uint64, err error) {
+	if imap.TypeOf(f) == imap.Number {
+		return uint64(imap.AsNumber(f)), nil
+	}
+	n, err = strconv.ParseUint(imap.AsAtom(f), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("Invalid number %q", imap.AsAtom(f))
+	}
+	return
+}
@@ -0,0 +1,62 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import "testing"
+
+func Test_parseStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  []imap.Field
+		want    MboxStatus
+		wantErr bool
+	}{
+		{"all items", []imap.Field{"STATUS", "INBOX", []imap.Field{
+			"MESSAGES", uint32(231), "RECENT", uint32(2), "UNSEEN", uint32(5), "UIDNEXT", uint32(44292),
+			"UIDVALIDITY", uint32(1), "HIGHESTMODSEQ", "7011231777", "SIZE", uint32(10240)}},
+			MboxStatus{Messages: 231, Recent: 2, Unseen: 5, UIDNext: 44292, UIDValidity: 1, HighestModSeq: 7011231777, Size: 10240}, false},
+		{"without label", []imap.Field{"INBOX", []imap.Field{"MESSAGES", uint32(3)}}, MboxStatus{Messages: 3}, false},
+		{"unknown item", []imap.Field{"INBOX", []imap.Field{"X-COUNT", uint32(9), "UNSEEN", uint32(1)}}, MboxStatus{Unseen: 1}, false},
+		{"missing value", []imap.Field{"INBOX", []imap.Field{"MESSAGES", uint32(3), "UNSEEN"}}, MboxStatus{Messages: 3}, false},
+		{"malformed value", []imap.Field{"INBOX", []imap.Field{"HIGHESTMODSEQ", "12x"}}, MboxStatus{}, true},
+		{"no item list", []imap.Field{"STATUS", "INBOX"}, MboxStatus{}, true},
+		{"item list not a list", []imap.Field{"INBOX", "MESSAGES"}, MboxStatus{}, true},
+	}
+	for _, tt := range tests {
+		st, err := parseStatus(tt.fields)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && st != tt.want {
+			t.Errorf("%s: parseStatus = %+v, want %+v", tt.name, st, tt.want)
+		}
+	}
+}
+
+func Test_fieldNumber(t *testing.T) {
+	tests := []struct {
+		f       imap.Field
+		want    uint64
+		wantErr bool
+	}{
+		{uint32(42), 42, false},
+		{"18446744073709551615", 1<<64 - 1, false},
+		{"-1", 0, true},
+		{"NIL", 0, true},
+	}
+	for _, tt := range tests {
+		n, err := fieldNumber(tt.f)
+		if n != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("fieldNumber(%v) = %d, %v, want %d", tt.f, n, err, tt.want)
+		}
+	}
+}
+
+func Test_selectedItems(t *testing.T) {
+	if !selectedItems([]string{"MESSAGES", "uidnext", "UNSEEN"}) {
+		t.Errorf("MESSAGES, UIDNEXT and UNSEEN can be taken from the selected mailbox")
+	}
+	if selectedItems([]string{"MESSAGES", "HIGHESTMODSEQ"}) {
+		t.Errorf("HIGHESTMODSEQ can not be taken from the selected mailbox")
+	}
+}
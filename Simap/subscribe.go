@@ -0,0 +1,79 @@
+package Simap
+
+import (
+	"context"
+	"sort"
+)
+
+//Subscribe adds mailbox name to the subscribed mailboxes, which most mail clients show.
+func (s *Session) Subscribe(ctx context.Context, name string) (err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	return s.wait(s.c.Subscribe(name))
+}
+
+//Unsubscribe removes mailbox name from the subscribed mailboxes.
+func (s *Session) Unsubscribe(ctx context.Context, name string) (err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	return s.wait(s.c.Unsubscribe(name))
+}
+
+//ReconcileSubscriptions unsubscribes the subscribed mailboxes which do not exist anymore
+//and, if subscribeAll is true, subscribes all existing mailboxes which are not subscribed and can hold messages.
+//It returns the names of the mailboxes it subscribed and unsubscribed.
+func (s *Session) ReconcileSubscriptions(ctx context.Context, subscribeAll bool) (added []string, removed []string, err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+	mboxes, err := s.list("", "*")
+	if err != nil {
+		return
+	}
+	subscribed, err := s.lsub("", "*")
+	if err != nil {
+		return
+	}
+	add, remove := reconcile(mboxes, subscribed, subscribeAll)
+	for _, name := range remove {
+		if err = s.wait(s.c.Unsubscribe(name)); err != nil {
+			return
+		}
+		removed = append(removed, name)
+	}
+	for _, name := range add {
+		if err = s.wait(s.c.Subscribe(name)); err != nil {
+			return
+		}
+		added = append(added, name)
+	}
+	s.log.Info("Reconciled subscriptions", "subscribed", len(added), "unsubscribed", len(removed))
+	return
+}
+
+//reconcile returns the mailboxes to subscribe and to unsubscribe for ReconcileSubscriptions.
+func reconcile(mboxes []MboxInfo, subscribed map[string]bool, subscribeAll bool) (add []string, remove []string) {
+	exists := make(map[string]bool, len(mboxes))
+	for _, m := range mboxes {
+		if m.HasAttr(`\NonExistent`) {
+			continue
+		}
+		exists[m.Name] = true
+		if subscribeAll && !subscribed[m.Name] && !m.HasAttr(`\Noselect`) {
+			add = append(add, m.Name)
+		}
+	}
+	for name := range subscribed {
+		if !exists[name] {
+			remove = append(remove, name)
+		}
+	}
+	sort.Strings(add)
+	sort.Strings(remove)
+	return
+}
@@ -0,0 +1,25 @@
+package Simap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_reconcile(t *testing.T) {
+	mboxes := []MboxInfo{
+		{Name: "INBOX"},
+		{Name: "Work", Attrs: []string{`\Noselect`, `\HasChildren`}},
+		{Name: "Work/2024"},
+		{Name: "Archive"},
+	}
+	subscribed := map[string]bool{"INBOX": true, "Work": true, "Old": true}
+
+	add, remove := reconcile(mboxes, subscribed, false)
+	if add != nil || !reflect.DeepEqual(remove, []string{"Old"}) {
+		t.Errorf("reconcile without subscribeAll = %q, %q", add, remove)
+	}
+	add, _ = reconcile(mboxes, subscribed, true)
+	if !reflect.DeepEqual(add, []string{"Archive", "Work/2024"}) {
+		t.Errorf("reconcile with subscribeAll added %q", add)
+	}
+}
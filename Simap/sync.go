@@ -0,0 +1,226 @@
+package Simap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+//Checkpoint is how far a mailbox has been synced by SyncEMails.
+type Checkpoint struct {
+	UIDValidity uint32 //UIDVALIDITY of the mailbox the UIDs are valid for
+	LastUID     uint32 //All messages up to this UID have been delivered
+	//HighestModSeq is the mod-sequence up to which the changes to the delivered messages have been passed on by SyncChanges,
+	//0 if the server does not support CONDSTORE, RFC 7162.
+	HighestModSeq uint64 `json:",omitempty"`
+}
+
+//CheckpointStore persists the Checkpoint of each mailbox of each account.
+//account identifies the account as Username@Host.
+type CheckpointStore interface {
+	//Load returns the checkpoint of mbox, ok is false if there is none yet.
+	Load(account string, mbox string) (cp Checkpoint, ok bool, err error)
+	Save(account string, mbox string, cp Checkpoint) error
+}
+
+//MemoryCheckpoints keeps checkpoints in memory, for processes which sync the same mailboxes repeatedly.
+//The zero value is ready to use.
+type MemoryCheckpoints struct {
+	mu  sync.Mutex
+	cps map[string]map[string]Checkpoint
+}
+
+func (m *MemoryCheckpoints) Load(account string, mbox string) (cp Checkpoint, ok bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp, ok = m.cps[account][mbox]
+	return
+}
+
+func (m *MemoryCheckpoints) Save(account string, mbox string, cp Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cps == nil {
+		m.cps = make(map[string]map[string]Checkpoint)
+	}
+	if m.cps[account] == nil {
+		m.cps[account] = make(map[string]Checkpoint)
+	}
+	m.cps[account][mbox] = cp
+	return nil
+}
+
+//FileCheckpoints keeps checkpoints in a JSON file at Path, which is replaced atomically on each Save.
+//Only one process should use the file at a time.
+type FileCheckpoints struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (f *FileCheckpoints) Load(account string, mbox string) (cp Checkpoint, ok bool, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cps, err := f.read()
+	if err != nil {
+		return
+	}
+	cp, ok = cps[account][mbox]
+	return
+}
+
+func (f *FileCheckpoints) Save(account string, mbox string, cp Checkpoint) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cps, err := f.read()
+	if err != nil {
+		return
+	}
+	if cps[account] == nil {
+		cps[account] = make(map[string]Checkpoint)
+	}
+	cps[account][mbox] = cp
+	data, err := json.MarshalIndent(cps, "", "\t")
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), filepath.Base(f.Path)+".*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if errC := tmp.Close(); err == nil {
+		err = errC
+	}
+	if err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), f.Path)
+}
+
+//read returns all checkpoints in the file, none if it does not exist yet.
+func (f *FileCheckpoints) read() (cps map[string]map[string]Checkpoint, err error) {
+	cps = make(map[string]map[string]Checkpoint)
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cps, nil
+	}
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &cps); err != nil {
+		err = fmt.Errorf("Reading checkpoints from %s: %w", f.Path, err)
+	}
+	return
+}
+
+//SyncEMails passes the messages of mailbox mbox which arrived since the last sync to fn
+//and records in store how far it got, so that every message is delivered once.
+//If there is no checkpoint for mbox yet or the UIDVALIDITY of mbox changed, which invalidates all UIDs,
+//all messages of mbox are passed to fn and resync is true: the caller should then drop what it knew about mbox.
+//
+//On servers supporting CONDSTORE, RFC 7162, SyncChanges passes on the changes to the delivered messages.
+//
+//The checkpoint is saved when fetching ends, also when it stops early, up to the highest UID below which
+//all messages were passed to fn. Messages after one which failed to be fetched are delivered again on the next sync.
+//Messages which can not be parsed are skipped for good and listed in the *BatchError with ErrMalformed.
+func (s *Session) SyncEMails(ctx context.Context, mbox string, store CheckpointStore, jobSize int, fn func(MsgData) error) (resync bool, err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	defer s.end(ctx, &err)
+
+	if mbox == "" {
+		mbox = "inbox"
+	}
+	account := s.acct.Username + "@" + s.acct.Server.Host
+	cp, ok, err := store.Load(account, mbox)
+	if err != nil {
+		return
+	}
+	var validity uint32
+	var modSeq uint64
+	var uids []uint32
+	err = s.retry(ctx, func() (err error) {
+		if condStore(s.c.Caps) { //Changes made while fetching are left to SyncChanges
+			st, err := s.status(mbox, "HIGHESTMODSEQ")
+			if err != nil {
+				return err
+			}
+			modSeq = st.HighestModSeq
+		}
+		if err = s.selectMbox(mbox, true); err != nil {
+			return
+		}
+		if s.c.Mailbox == nil || s.c.Mailbox.UIDValidity == 0 {
+			return errors.New("Server did not report UIDVALIDITY")
+		}
+		validity = s.c.Mailbox.UIDValidity
+		last := cp.LastUID
+		if !ok || cp.UIDValidity != validity {
+			last = 0
+		}
+		uids, err = s.searchUIDs(fmt.Sprintf("UID %d:*", last+1))
+		return
+	})
+	if err != nil {
+		return
+	}
+	if resync = !ok || cp.UIDValidity != validity; resync {
+		s.log.Info("Full resync", "mailbox", mbox, "uidValidity", validity, "previousUIDValidity", cp.UIDValidity)
+		cp = Checkpoint{UIDValidity: validity, HighestModSeq: modSeq}
+	}
+	uids = newerUIDs(uids, cp.LastUID)
+
+	res, err := s.fetchUIDs(ctx, mbox, uids, jobSize, fn)
+	last := lastDelivered(uids, res, cp.LastUID)
+	if last != cp.LastUID || resync {
+		cp.LastUID = last
+		if errS := store.Save(account, mbox, cp); err == nil {
+			err = errS
+		}
+	}
+	return
+}
+
+//newerUIDs returns the UIDs of uids greater than last in ascending order.
+//"UID n:*" also matches the last message when all UIDs are below n.
+func newerUIDs(uids []uint32, last uint32) (newer []uint32) {
+	for _, uid := range uids {
+		if uid > last {
+			newer = append(newer, uid)
+		}
+	}
+	sort.Slice(newer, func(i, j int) bool { return newer[i] < newer[j] })
+	return
+}
+
+//lastDelivered returns the highest of the ascending uids up to which all are done, or last if the first is not.
+//A message is done if it was passed to fn or failed with the permanent ErrMalformed, so that it does not hold sync back forever.
+func lastDelivered(uids []uint32, res *Result, last uint32) uint32 {
+	done := make(map[uint32]bool, len(res.Succeeded))
+	for _, uid := range res.Succeeded {
+		done[uid] = true
+	}
+	for _, f := range res.Failed {
+		if errors.Is(f.Err, ErrMalformed) {
+			for _, uid := range f.UIDs {
+				done[uid] = true
+			}
+		}
+	}
+	for _, uid := range uids {
+		if !done[uid] {
+			break
+		}
+		last = uid
+	}
+	return last
+}
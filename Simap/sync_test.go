@@ -0,0 +1,101 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_CheckpointStores(t *testing.T) {
+	stores := map[string]CheckpointStore{
+		"memory": new(MemoryCheckpoints),
+		"file":   &FileCheckpoints{Path: filepath.Join(t.TempDir(), "checkpoints.json")},
+	}
+	for name, store := range stores {
+		if _, ok, err := store.Load("user@imap.example.com", "INBOX"); ok || err != nil {
+			t.Errorf("%s: empty store returned a checkpoint or %v", name, err)
+		}
+		cp := Checkpoint{UIDValidity: 1234, LastUID: 56, HighestModSeq: 1 << 40}
+		if err := store.Save("user@imap.example.com", "INBOX", cp); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := store.Save("user@imap.example.com", "Sent", Checkpoint{UIDValidity: 1, LastUID: 2}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, ok, err := store.Load("user@imap.example.com", "INBOX")
+		if !ok || err != nil || got != cp {
+			t.Errorf("%s: Load = %+v, %v, %v, want %+v", name, got, ok, err, cp)
+		}
+		if _, ok, _ := store.Load("other@imap.example.com", "INBOX"); ok {
+			t.Errorf("%s: checkpoints of accounts should be kept apart", name)
+		}
+	}
+}
+
+func Test_newerUIDs(t *testing.T) {
+	if got := newerUIDs([]uint32{12, 9, 15}, 10); !reflect.DeepEqual(got, []uint32{12, 15}) {
+		t.Errorf("newerUIDs = %v, want [12 15]", got)
+	}
+	if got := newerUIDs([]uint32{10}, 10); got != nil {
+		t.Errorf("UID n:* matching only the last message should give no UIDs, got %v", got)
+	}
+}
+
+func Test_lastDelivered(t *testing.T) {
+	uids := []uint32{11, 12, 14, 20}
+	tests := []struct {
+		delivered []uint32
+		want      uint32
+	}{
+		{[]uint32{11, 12, 14, 20}, 20},
+		{[]uint32{12, 11, 20}, 12},
+		{[]uint32{12, 14}, 10},
+		{nil, 10},
+	}
+	for _, tt := range tests {
+		if got := lastDelivered(uids, &Result{Succeeded: tt.delivered}, 10); got != tt.want {
+			t.Errorf("lastDelivered(%v) = %d, want %d", tt.delivered, got, tt.want)
+		}
+	}
+}
+
+func fetchResponse(uid uint32, mime string) *imap.Response {
+	return &imap.Response{Type: imap.Data, Label: "FETCH", Fields: []imap.Field{uid, "FETCH",
+		[]imap.Field{"UID", uid, "RFC822", []byte(mime)}}}
+}
+
+func Test_SyncSkipsMalformed(t *testing.T) {
+	good := "From: a@example.com\r\nSubject: hi\r\n\r\nbody\r\n"
+	rsps := []*imap.Response{
+		fetchResponse(11, good),
+		fetchResponse(12, "not a header line\r\n\r\nbody\r\n"),
+		fetchResponse(13, good),
+	}
+	res := new(Result)
+	var errFn error
+	deliver := deliverFetched(func(msg MsgData) error {
+		res.add([]uint32{msg.Imap_uid}, nil)
+		return nil
+	}, func(uid uint32, err error) {
+		res.add([]uint32{uid}, err)
+	}, &errFn)
+	for _, rsp := range rsps {
+		deliver(rsp)
+	}
+	if !reflect.DeepEqual(res.Succeeded, []uint32{11, 13}) || !reflect.DeepEqual(res.FailedUIDs(), []uint32{12}) {
+		t.Fatalf("Succeeded = %v, Failed = %v", res.Succeeded, res.FailedUIDs())
+	}
+	if !errors.Is(res.err("Fetching"), ErrMalformed) {
+		t.Errorf("the malformed message should be reported with ErrMalformed")
+	}
+	if got := lastDelivered([]uint32{11, 12, 13}, res, 10); got != 13 {
+		t.Errorf("a malformed message should not hold the checkpoint back, got %d", got)
+	}
+	res.add([]uint32{14}, ErrNotFetched)
+	res.add([]uint32{15}, nil)
+	if got := lastDelivered([]uint32{11, 12, 13, 14, 15}, res, 10); got != 13 {
+		t.Errorf("a message which was not fetched should hold the checkpoint back, got %d", got)
+	}
+}
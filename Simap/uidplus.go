@@ -0,0 +1,114 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//respCode returns the arguments of response code label, e.g. COPYUID, of the first of rsps having it.
+func respCode(label string, rsps ...*imap.Response) (args []imap.Field, ok bool) {
+	for _, rsp := range rsps {
+		if rsp == nil || !strings.EqualFold(rsp.Label, label) {
+			continue
+		}
+		args = rsp.Fields
+		if len(args) > 0 && imap.TypeOf(args[0]) == imap.Atom && strings.EqualFold(imap.AsAtom(args[0]), label) {
+			args = args[1:]
+		}
+		return args, true
+	}
+	return
+}
+
+//copyUID parses the COPYUID response code of UIDPLUS, RFC 4315, from rsps.
+//It returns the UIDVALIDITY of the destination mailbox and the UIDs of the copies of the messages with UIDs src.
+func copyUID(rsps ...*imap.Response) (validity uint32, src []uint32, dst []uint32, err error) {
+	args, ok := respCode("COPYUID", rsps...)
+	if !ok {
+		return
+	}
+	if len(args) != 3 {
+		err = fmt.Errorf("Invalid COPYUID response code with %d arguments", len(args))
+		return
+	}
+	validity = imap.AsNumber(args[0])
+	if src, err = fieldUIDs(args[1]); err != nil {
+		return
+	}
+	if dst, err = fieldUIDs(args[2]); err != nil {
+		return
+	}
+	if len(src) != len(dst) {
+		err = fmt.Errorf("COPYUID maps %d UIDs to %d UIDs", len(src), len(dst))
+	}
+	return
+}
+
+//fieldUIDs returns the UIDs of field f holding a single UID or a uid-set.
+func fieldUIDs(f imap.Field) ([]uint32, error) {
+	if imap.TypeOf(f) == imap.Number {
+		return []uint32{imap.AsNumber(f)}, nil
+	}
+	return parseUIDSet(imap.AsAtom(f))
+}
+
+//maxUIDSetSize bounds the number of UIDs parseUIDSet expands a uid-set sent by the server to.
+const maxUIDSetSize = 1 << 20
+
+//parseUIDSet returns the UIDs of a uid-set such as "4,7:9" in the order they are listed.
+//Ranges are expanded in ascending order as RFC 4315 requires for COPYUID.
+func parseUIDSet(set string) (uids []uint32, err error) {
+	for _, part := range strings.Split(set, ",") {
+		lo, hi, isRange := strings.Cut(part, ":")
+		first, err1 := strconv.ParseUint(lo, 10, 32)
+		last := first
+		if err1 == nil && isRange {
+			last, err1 = strconv.ParseUint(hi, 10, 32)
+		}
+		if err1 != nil || first == 0 || last == 0 {
+			err = fmt.Errorf("Invalid uid-set %q", set)
+			return nil, err
+		}
+		if first > last {
+			first, last = last, first
+		}
+		if uint64(len(uids))+last-first >= maxUIDSetSize {
+			err = fmt.Errorf("uid-set %q has too many UIDs", set)
+			return nil, err
+		}
+		for uid := first; uid <= last; uid++ {
+			uids = append(uids, uint32(uid))
+		}
+	}
+	return
+}
+
+//uidMapping is the COPYUID of one job.
+type uidMapping struct {
+	validity uint32
+	src      []uint32
+	dst      []uint32
+}
+
+//copyJob copies the messages with uids to mailbox dst, with UID MOVE if move is true.
+//The returned mapping is empty if the server does not support UIDPLUS.
+func (s *Session) copyJob(uids []uint32, dst string, move bool) (m uidMapping, err error) {
+	var rsp *imap.Response
+	var data []*imap.Response
+	if move {
+		rsp, data, err = s.result(s.uidMove(uidSet(uids), dst))
+	} else {
+		rsp, data, err = s.result(s.c.UIDCopy(uidSet(uids), dst))
+	}
+	if err != nil {
+		return
+	}
+	m.validity, m.src, m.dst, err = copyUID(append(data, rsp)...)
+	if err != nil { //The messages were copied all the same
+		s.log.Warn("Ignoring COPYUID", "mailbox", dst, "error", err)
+		m, err = uidMapping{}, nil
+	}
+	return
+}
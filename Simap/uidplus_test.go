@@ -0,0 +1,34 @@
+package Simap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseUIDSet(t *testing.T) {
+	uids, err := parseUIDSet("4,7:9,12:11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(uids, []uint32{4, 7, 8, 9, 11, 12}) {
+		t.Errorf("parseUIDSet = %v", uids)
+	}
+	for _, bad := range []string{"", "1:", "a", "0", "1,*", "1:4294967295"} {
+		if _, err := parseUIDSet(bad); err == nil {
+			t.Errorf("parseUIDSet(%q) should fail", bad)
+		}
+	}
+}
+
+func Test_ResultAddMapping(t *testing.T) {
+	res := new(Result)
+	res.addMapping(uidMapping{})
+	if res.UIDMap != nil {
+		t.Errorf("an empty COPYUID should leave UIDMap nil")
+	}
+	res.addMapping(uidMapping{38505, []uint32{304, 319, 320}, []uint32{3956, 3957, 3958}})
+	want := map[uint32]uint32{304: 3956, 319: 3957, 320: 3958}
+	if res.UIDValidity != 38505 || !reflect.DeepEqual(res.UIDMap, want) {
+		t.Errorf("UIDValidity %d, UIDMap %v", res.UIDValidity, res.UIDMap)
+	}
+}
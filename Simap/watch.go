@@ -0,0 +1,259 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+//WatchEventKind tells what changed in a watched mailbox.
+type WatchEventKind int
+
+const (
+	//WatchExists reports the number of messages in the mailbox, which grows when new messages arrive.
+	WatchExists WatchEventKind = iota + 1
+	//WatchExpunge reports that the message with sequence number Seq was removed.
+	//The sequence numbers of the following messages decrease by one.
+	WatchExpunge
+	//WatchFlags reports the flags of the message with sequence number Seq, and its UID if the server sent it.
+	WatchFlags
+	//WatchVanished reports that the messages with UIDs were removed. It replaces WatchExpunge
+	//once ChangesSince has enabled QRESYNC, RFC 7162, on the connection.
+	WatchVanished
+)
+
+func (k WatchEventKind) String() string {
+	switch k {
+	case WatchExists:
+		return "EXISTS"
+	case WatchExpunge:
+		return "EXPUNGE"
+	case WatchFlags:
+		return "FETCH"
+	case WatchVanished:
+		return "VANISHED"
+	}
+	return "none"
+}
+
+//WatchEvent is a change in a mailbox watched by Watch.
+type WatchEvent struct {
+	Kind    WatchEventKind
+	Mailbox string
+	Count   uint32   //Number of messages for WatchExists
+	Seq     uint32   //Sequence number of the message for WatchExpunge and WatchFlags
+	UID     uint32   //UID of the message for WatchFlags, 0 if unknown
+	Flags   []string //Flags of the message for WatchFlags, sorted
+	UIDs    []uint32 //UIDs of the messages for WatchVanished
+}
+
+const (
+	//idleRefresh is how long an IDLE command lasts before it is renewed,
+	//servers may log out clients idle for 30 minutes, RFC 2177.
+	idleRefresh = 25 * time.Minute
+	//noopInterval is how often servers without IDLE are polled with NOOP.
+	noopInterval = 30 * time.Second
+)
+
+//errStopped is returned by the watch loops when ctx is done and the connection was left idle.
+var errStopped = errors.New("Watch stopped")
+
+//Watch selects mailbox mbox and calls handler for each change the server reports in it
+//until ctx is done or handler returns an error, which Watch then returns.
+//It waits with IDLE, RFC 2177, renewed every 25 minutes, or polls with NOOP if the server does not support IDLE.
+//
+//Right after mbox is selected a WatchExists event gives its current number of messages.
+//When the connection fails Watch reconnects, selects mbox again and goes on with a new WatchExists event,
+//as messages may have arrived meanwhile. It retries according to Options.Retry
+//or, if it is nil, forever with the default delays of RetryPolicy.
+func (s *Session) Watch(ctx context.Context, mbox string, handler func(WatchEvent) error) (err error) {
+	if err = s.begin(ctx); err != nil {
+		return
+	}
+	if mbox == "" {
+		mbox = "inbox"
+	}
+	policy := &RetryPolicy{}
+	if s.acct.Options != nil && s.acct.Options.Retry != nil {
+		policy = s.acct.Options.Retry
+	}
+	var errH error
+	handle := func(ev WatchEvent) error {
+		errH = handler(ev)
+		return errH
+	}
+
+	attempt := 0
+	for {
+		var selected bool
+		selected, err = s.watch(ctx, mbox, handle)
+		switch {
+		case errH != nil:
+			return errH
+		case err == errStopped:
+			return ctx.Err()
+		case ctx.Err() != nil: //Stopped in the middle of a command
+			s.abort()
+			return ctx.Err()
+		}
+		if selected {
+			attempt = 0
+		}
+		for {
+			if !policy.retryable(err) || policy.MaxAttempts > 0 && attempt+1 >= policy.MaxAttempts {
+				return
+			}
+			attempt++
+			d := policy.delay(attempt)
+			s.log.Warn("Reconnecting to watch", "mailbox", mbox, "attempt", attempt, "delay", d, "error", err)
+			s.obs.emit(Event{Kind: EventRetry, Mailbox: mbox, Err: err})
+			t := time.NewTimer(d)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				s.abort()
+				return ctx.Err()
+			}
+			if err = s.reconnect(ctx); err == nil {
+				break
+			}
+		}
+	}
+}
+
+//watch selects mbox and passes its changes to handler until an error occurs.
+//selected tells whether mbox could be selected.
+func (s *Session) watch(ctx context.Context, mbox string, handler func(WatchEvent) error) (selected bool, err error) {
+	if err = s.selectMbox(mbox, true); err != nil {
+		return
+	}
+	selected = true
+	s.c.Data = nil
+	if s.c.Mailbox != nil {
+		if err = handler(WatchEvent{Kind: WatchExists, Mailbox: mbox, Count: s.c.Mailbox.Messages}); err != nil {
+			return
+		}
+	}
+	s.log.Info("Watching", "mailbox", mbox, "idle", s.c.Caps["IDLE"])
+	if s.c.Caps["IDLE"] {
+		return selected, s.idle(ctx, mbox, handler)
+	}
+	return selected, s.poll(ctx, mbox, handler)
+}
+
+//idle waits for changes with IDLE, terminating and renewing it every idleRefresh.
+func (s *Session) idle(ctx context.Context, mbox string, handler func(WatchEvent) error) error {
+	for {
+		cmd, err := s.c.Idle()
+		if err != nil {
+			return err
+		}
+		finished := s.commandStarted(cmd)
+		idleCtx, cancel := context.WithTimeout(ctx, idleRefresh)
+		var errH error
+		for err == nil && errH == nil {
+			err = recv(idleCtx, s.c)
+			errH = s.dispatch(mbox, handler, cmd.Data, s.c.Data)
+			cmd.Data, s.c.Data = nil, nil
+		}
+		cancel()
+		if err != nil && idleCtx.Err() == nil {
+			finished(err)
+			return err
+		}
+
+		//Renewing, stopping or the handler failed, IDLE has to be terminated in all cases.
+		//IdleTerm completes the IDLE command, whose EventCommandStart was sent above.
+		termCtx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+		var data []*imap.Response
+		cmd, errT := s.c.IdleTerm()
+		_, errT = waitResp(termCtx, cmd, errT, s.log, func(rsp *imap.Response) { data = append(data, rsp) })
+		finished(errT)
+		cancel()
+		switch {
+		case errH != nil:
+			return errH
+		case errT != nil:
+			return errT
+		}
+		if err = s.dispatch(mbox, handler, data, s.c.Data); err != nil {
+			return err
+		}
+		s.c.Data = nil
+		if ctx.Err() != nil {
+			return errStopped
+		}
+	}
+}
+
+//poll asks for changes with NOOP every noopInterval.
+func (s *Session) poll(ctx context.Context, mbox string, handler func(WatchEvent) error) error {
+	t := time.NewTicker(noopInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return errStopped
+		}
+		_, data, err := s.result(s.c.Noop())
+		if err != nil {
+			return err
+		}
+		if err = s.dispatch(mbox, handler, data, s.c.Data); err != nil {
+			return err
+		}
+		s.c.Data = nil
+	}
+}
+
+//dispatch passes the EXISTS, EXPUNGE, VANISHED and FETCH responses among rsps to handler.
+func (s *Session) dispatch(mbox string, handler func(WatchEvent) error, rsps ...[]*imap.Response) error {
+	for _, list := range rsps {
+		for _, rsp := range list {
+			ev, ok := watchEvent(rsp)
+			if !ok {
+				continue
+			}
+			ev.Mailbox = mbox
+			if err := handler(ev); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//watchEvent returns the WatchEvent of an untagged response, ok is false for other responses.
+func watchEvent(rsp *imap.Response) (ev WatchEvent, ok bool) {
+	if rsp.Type != imap.Data {
+		return
+	}
+	switch rsp.Label {
+	case "EXISTS":
+		return WatchEvent{Kind: WatchExists, Count: rsp.Value()}, true
+	case "EXPUNGE":
+		return WatchEvent{Kind: WatchExpunge, Seq: rsp.Value()}, true
+	case "VANISHED":
+		uids, err := vanishedUIDs(rsp)
+		if err != nil {
+			return
+		}
+		return WatchEvent{Kind: WatchVanished, UIDs: uids}, true
+	case "FETCH":
+		info := rsp.MessageInfo()
+		if info == nil || info.Flags == nil {
+			return
+		}
+		ev = WatchEvent{Kind: WatchFlags, Seq: info.Seq, UID: info.UID}
+		for flag := range info.Flags {
+			ev.Flags = append(ev.Flags, flag)
+		}
+		sort.Strings(ev.Flags)
+		return ev, true
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package Simap
+
+import "code.google.com/p/go-imap/go1/imap"
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func Test_watchEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		rsp  *imap.Response
+		want WatchEvent
+		ok   bool
+	}{
+		{"EXISTS", &imap.Response{Type: imap.Data, Label: "EXISTS", Fields: []imap.Field{uint32(23), "EXISTS"}},
+			WatchEvent{Kind: WatchExists, Count: 23}, true},
+		{"EXPUNGE", &imap.Response{Type: imap.Data, Label: "EXPUNGE", Fields: []imap.Field{uint32(4), "EXPUNGE"}},
+			WatchEvent{Kind: WatchExpunge, Seq: 4}, true},
+		{"FETCH FLAGS", &imap.Response{Type: imap.Data, Label: "FETCH", Fields: []imap.Field{uint32(7), "FETCH",
+			[]imap.Field{"UID", uint32(107), "FLAGS", []imap.Field{`\Seen`, `\Flagged`}}}},
+			WatchEvent{Kind: WatchFlags, Seq: 7, UID: 107, Flags: []string{`\Flagged`, `\Seen`}}, true},
+		{"VANISHED", &imap.Response{Type: imap.Data, Label: "VANISHED", Fields: []imap.Field{"VANISHED", "41,43:44"}},
+			WatchEvent{Kind: WatchVanished, UIDs: []uint32{41, 43, 44}}, true},
+		{"FETCH without FLAGS", &imap.Response{Type: imap.Data, Label: "FETCH", Fields: []imap.Field{uint32(7), "FETCH",
+			[]imap.Field{"UID", uint32(107)}}}, WatchEvent{}, false},
+		{"RECENT", &imap.Response{Type: imap.Data, Label: "RECENT", Fields: []imap.Field{uint32(1), "RECENT"}}, WatchEvent{}, false},
+		{"tagged", &imap.Response{Type: imap.Done, Status: imap.OK, Label: "EXISTS"}, WatchEvent{}, false},
+	}
+	for _, tt := range tests {
+		ev, ok := watchEvent(tt.rsp)
+		if ok != tt.ok || !reflect.DeepEqual(ev, tt.want) {
+			t.Errorf("%s: watchEvent = %+v, %v, want %+v, %v", tt.name, ev, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func Test_dispatch(t *testing.T) {
+	s := &Session{}
+	var got []WatchEventKind
+	handler := func(ev WatchEvent) error {
+		if ev.Mailbox != "INBOX" {
+			t.Errorf("event without the mailbox: %+v", ev)
+		}
+		got = append(got, ev.Kind)
+		return nil
+	}
+	cmdData := []*imap.Response{{Type: imap.Data, Label: "EXISTS", Fields: []imap.Field{uint32(3), "EXISTS"}}}
+	unilateral := []*imap.Response{
+		{Type: imap.Data, Label: "RECENT", Fields: []imap.Field{uint32(1), "RECENT"}},
+		{Type: imap.Data, Label: "EXPUNGE", Fields: []imap.Field{uint32(2), "EXPUNGE"}},
+	}
+	if err := s.dispatch("INBOX", handler, cmdData, unilateral); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []WatchEventKind{WatchExists, WatchExpunge}) {
+		t.Errorf("dispatched %v, want [EXISTS EXPUNGE]", got)
+	}
+	stop := errors.New("stop")
+	err := s.dispatch("INBOX", func(WatchEvent) error { return stop }, cmdData, unilateral)
+	if err != stop {
+		t.Errorf("dispatch should return the error of the handler, got %v", err)
+	}
+}
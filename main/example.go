@@ -2,71 +2,226 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/pruthvirajsinh/go-Simap/Simap"
+	"log/slog"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"time"
 )
 
 var query = flag.String("query", "after:2012/09/12", "query to limit fetch")
 var mbox = flag.String("mbox", "inbox", "name of mail box/folder from which you want to get mail")
-var destBox = flag.String("dbox", "", "name of mail box/folder where you want to move mail")
+var destBox = flag.String("dbox", "", "name of mail box/folder where you want to move mail, or a special use such as \\Trash or \\Archive")
 var jobSize = flag.Int("jobsize", 2, "Number of Emails to be processed at a time")
 var move = flag.Bool("move", false, "Weateher to move or copy the mails while dbox is given")
 var del = flag.Bool("delete", false, "Just Delete the fetched mails.Just to check Delete Functionality.")
 var skipCerti = flag.Bool("skipCerti", false, "If your IMAP server uses self signed certi then make this true to skip Certification verification.")
 var imapFlag = flag.String("imapflag", "", "Flag the emails")
+var workers = flag.Int("workers", 1, "Number of connections to spread the jobs over")
+var security = flag.String("security", "tls", "How to secure the connection: tls, starttls, starttls-optional or none (loopback only)")
+var insecureAuth = flag.Bool("insecureAuth", false, "Allow sending the password over an unencrypted connection.")
+var caFile = flag.String("cafile", "", "PEM file of CAs trusted to sign the certificate of the IMAP server")
+var certFile = flag.String("cert", "", "PEM client certificate for servers requiring TLS client authentication")
+var keyFile = flag.String("key", "", "PEM private key of the client certificate")
+var oauth = flag.Bool("oauth", false, "Treat the password as an OAuth 2.0 access token and log in with OAUTHBEARER or XOAUTH2")
+var passEnv = flag.String("passenv", "SIMAP_PASSWORD", "Environment variable holding the password")
+var passFile = flag.String("passfile", "", "File holding the password, must have mode 0600")
+var passCmd = flag.String("passcmd", "", "Command printing the password, run through sh -c")
+var useNetrc = flag.Bool("netrc", false, "Look up the password in ~/.netrc")
+var mechanism = flag.String("mechanism", "", "Only log in with this authentication mechanism, e.g. PLAIN, SCRAM-SHA-256 or LOGIN")
+var verbose = flag.Bool("v", false, "Log every command and response of the IMAP session")
+var retries = flag.Int("retries", 3, "Number of times a batch is tried when the connection drops or the server is unavailable")
+var list = flag.Bool("list", false, "Only list the mailboxes of the account")
+var status = flag.Bool("status", false, "Only print the message counts of mbox")
+var watch = flag.Bool("watch", false, "Only print the changes of mbox as they happen, until interrupted")
+var checkpoints = flag.String("checkpoints", "", "JSON file of sync checkpoints, fetch only the mails of mbox which arrived since the last run instead of using query")
+var appendFile = flag.String("append", "", "File holding a raw message to upload to mbox before fetching")
+var subscribe = flag.Bool("subscribe", false, "Subscribe dbox if it has to be created")
+var showMetrics = flag.Bool("metrics", false, "Print the metrics of the session in Prometheus text format when done")
+var pin = flag.String("pin", "", "Base64 SHA-256 hash of the public key the IMAP server certificate must have")
 
 func usage() {
-	fmt.Fprintf(os.Stderr, "usage: main [server] [port] [username] [password]\n")
+	fmt.Fprintf(os.Stderr, "usage: main [server] [port] [username]\n")
 	flag.PrintDefaults()
 	os.Exit(2)
 }
 
 //Example
 //To Copy all the Read mails since 1st,April 2014 fom inbox to processed.
-//./main --skipCerti=false --query="SINCE 01-APR-2014 SEEN" --mbox=inbox --dbox=processed imap.gmail.com 993 user@gmail.com supersecretpassword
+//SIMAP_PASSWORD=supersecretpassword ./main --skipCerti=false --query="SINCE 01-APR-2014 SEEN" --mbox=inbox --dbox=processed imap.gmail.com 993 user@gmail.com
 
 func main() {
 	flag.Usage = usage
 	flag.Parse()
 
 	args := flag.Args()
-	if len(args) != 4 {
+	if len(args) != 3 {
 		usage()
 	}
 	portI, _ := strconv.Atoi(args[1])
 	port := uint16(portI)
-	server := &Simap.IMAPServer{args[0], port}
-	acct := &Simap.IMAPAccount{args[2], args[3], server}
+	sec, err := Simap.ParseSecurity(*security)
+	if err != nil {
+		fmt.Println(err)
+		usage()
+	}
+	tlsOpts := &Simap.TLSOptions{PinSHA256: *pin}
+	if *caFile != "" {
+		tlsOpts.RootCAs, err = Simap.LoadCAFile(*caFile)
+		if err != nil {
+			fmt.Println("Error while loading CAs ", err)
+			return
+		}
+	}
+	if *certFile != "" {
+		cert, errC := tls.LoadX509KeyPair(*certFile, *keyFile)
+		if errC != nil {
+			fmt.Println("Error while loading client certificate ", errC)
+			return
+		}
+		tlsOpts.Certificates = []tls.Certificate{cert}
+	}
+	server := &Simap.IMAPServer{Host: args[0], Port: port, Security: sec, AllowInsecureAuth: *insecureAuth, TLS: tlsOpts}
+	acct := &Simap.IMAPAccount{Username: args[2], Server: server, Mechanism: *mechanism}
+	level := slog.LevelInfo
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	acct.Options = &Simap.Options{Workers: *workers, Logger: logger}
+	acct.Options.Retry = &Simap.RetryPolicy{MaxAttempts: *retries, Jitter: 0.2}
+	if *showMetrics {
+		metrics := Simap.NewMetrics()
+		acct.Options.Observer = metrics
+		defer metrics.WriteTo(os.Stdout)
+	}
+	switch {
+	case *passFile != "":
+		acct.Credentials = Simap.FileCredentials{Path: *passFile}
+	case *passCmd != "":
+		acct.Credentials = Simap.CommandCredentials{Name: "sh", Args: []string{"-c", *passCmd}}
+	case *useNetrc:
+		acct.Credentials = Simap.NetrcCredentials{}
+	default:
+		acct.Credentials = Simap.EnvCredentials{Var: *passEnv}
+	}
+	if *oauth {
+		acct.TokenSource = Simap.TokenSourceFunc(func() (string, error) { return acct.Credentials.Password(acct) })
+	}
 
-	mails, err := Simap.GetEMails(acct, *query, *mbox, *jobSize, *skipCerti)
+	ctx := context.Background()
+
+	//One session is used for all the operations below.
+	s, err := Simap.NewSession(ctx, acct, *skipCerti)
 	if err != nil {
-		fmt.Println("Error while Getting mails ", err)
+		fmt.Println("Error while Logging in ", err)
+		return
+	}
+	defer s.Logout()
+
+	if *list {
+		mboxes, errL := s.ListMailboxes(ctx, "", "*")
+		if errL != nil {
+			fmt.Println("Error while Listing ", errL)
+			return
+		}
+		for _, m := range mboxes {
+			fmt.Println(m.Name, m.Attrs, "subscribed:", m.Subscribed)
+		}
+		return
+	}
+
+	if *status {
+		statuses, errS := s.MailboxStatus(ctx, *mbox)
+		if errS != nil {
+			fmt.Println("Error while getting Status ", errS)
+			return
+		}
+		st := statuses[0]
+		fmt.Printf("%s: %d messages, %d unseen, %d recent, UIDNEXT %d, UIDVALIDITY %d\n", st.Name, st.Messages, st.Unseen, st.Recent, st.UIDNext, st.UIDValidity)
 		return
 	}
+
+	if *watch {
+		watchCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+		err = s.Watch(watchCtx, *mbox, func(ev Simap.WatchEvent) error {
+			fmt.Println(ev.Kind, "count:", ev.Count, "seq:", ev.Seq, "uid:", ev.UID, "flags:", ev.Flags)
+			return nil
+		})
+		if err != nil && err != context.Canceled {
+			fmt.Println("Error while Watching ", err)
+		}
+		return
+	}
+
+	if *appendFile != "" {
+		msg, errR := os.ReadFile(*appendFile)
+		if errR != nil {
+			fmt.Println("Error while reading ", errR)
+			return
+		}
+		uid, errA := s.AppendMessage(ctx, *mbox, msg, []string{`\Seen`}, time.Now())
+		if errA != nil {
+			fmt.Println("Error while Appending ", errA)
+			return
+		}
+		fmt.Println("Appended message with UID", uid)
+	}
+
 	var uids []uint32
-	fmt.Println("Fetched Mails ", len(mails))
 	fmt.Println("UID		|	From		|	To		|		Subject		|Body	| HTMLBODY	|GPGBody")
-	for _, msg := range mails {
+	//Mails are processed one by one as they are fetched.
+	process := func(msg Simap.MsgData) error {
 		//PRocess Emails here
 		errP := processEmail(msg)
 		if errP != nil {
-			continue
+			return nil
 		}
 		//If successfull then append them to be moved to processed
 		uids = append(uids, msg.Imap_uid)
+		return nil
 	}
+	if *checkpoints != "" {
+		store := &Simap.FileCheckpoints{Path: *checkpoints}
+		//Changes to the mails processed by earlier runs, on servers supporting CONDSTORE
+		_, errC := s.SyncChanges(ctx, *mbox, store, func(ch *Simap.Changes) error {
+			for _, fc := range ch.Flags {
+				fmt.Println("Flags of", fc.UID, "changed to", fc.Flags)
+			}
+			if len(ch.Vanished) > 0 {
+				fmt.Println("Expunged", ch.Vanished)
+			}
+			return nil
+		})
+		if errC != nil && !errors.Is(errC, Simap.ErrNoCondStore) {
+			fmt.Println("Error while Syncing changes ", errC)
+		}
+		_, err = s.SyncEMails(ctx, *mbox, store, *jobSize, process)
+	} else {
+		err = s.StreamEMails(ctx, *query, *mbox, *jobSize, process)
+	}
+	if err != nil {
+		fmt.Println("Error while Getting mails ", err)
+		return
+	}
+	fmt.Println("Processed Mails ", len(uids))
 	if *imapFlag != "" {
-		err = Simap.MarkEmails(acct, *mbox, *imapFlag, uids, *jobSize, *skipCerti)
+		_, err = s.MarkEmails(ctx, *mbox, *imapFlag, uids, *jobSize)
 		if err != nil {
 			fmt.Println("Main : Error while Marking ", err)
 		}
 	}
 
 	if *del == true {
-		err = Simap.DeleteEmails(acct, *mbox, uids, *jobSize, *skipCerti)
+		_, err = s.DeleteEmails(ctx, *mbox, uids, *jobSize)
 		if err != nil {
 			fmt.Println("Main : Error while Deleting ", err)
 		}
@@ -74,14 +229,30 @@ func main() {
 
 	}
 
+	if strings.HasPrefix(*destBox, `\`) {
+		*destBox, err = s.SpecialMailbox(ctx, Simap.SpecialUse(*destBox))
+		if err != nil {
+			fmt.Println("Error while finding the destination mailbox ", err)
+			return
+		}
+	}
 	if *destBox != "" {
+		if *subscribe {
+			if err = s.CreateMbox(ctx, *destBox, true); err != nil {
+				fmt.Println("Error while Creating ", err)
+				return
+			}
+		}
 		if *move == true {
-			err = Simap.MoveEmails(acct, *mbox, *destBox, uids, *jobSize, *skipCerti)
+			res, err := s.MoveEmails(ctx, *mbox, *destBox, uids, *jobSize)
 			if err != nil {
 				fmt.Println("Eror while moving ", err)
 			}
+			if res != nil {
+				fmt.Println("Moved with", res.Strategy)
+			}
 		} else {
-			err = Simap.CopyEmails(acct, *mbox, *destBox, uids, *jobSize, *skipCerti)
+			_, err = s.CopyEmails(ctx, *mbox, *destBox, uids, *jobSize)
 			if err != nil {
 				fmt.Println("Eror while Copying ", err)
 			}